@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const mask = "xxxxx" // like url.URL.Redacted
+
+// authConfig describes how a request is authenticated, only one method should
+// be set. An empty auth object disables the authentication of the default
+// test.
+type authConfig struct {
+	Basic  *basicAuth  `json:"basic"`
+	Bearer *bearerAuth `json:"bearer"`
+	APIKey *apiKeyAuth `json:"apiKey"`
+	OAuth2 *oauth2Auth `json:"oauth2"`
+	Digest *digestAuth `json:"digest"`
+}
+
+type basicAuth struct {
+	User     string `json:"user"`
+	Password string `json:"password"`
+}
+
+type bearerAuth struct {
+	Token string `json:"token"`
+}
+
+type apiKeyAuth struct {
+	In    string `json:"in"` // header or query
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// prepareAuth adds the credentials to the request, the values are expanded as
+// template.
+func (t *Test) prepareAuth() {
+	auth := t.Request.Auth
+	if auth == nil {
+		return
+	}
+	var err error
+	switch {
+	case auth.Basic != nil:
+		var user, password string
+		if user, err = expandTemplate("auth.basic.user", auth.Basic.User); err != nil {
+			break
+		}
+		if password, err = expandTemplate("auth.basic.password", auth.Basic.Password); err != nil {
+			break
+		}
+		t.request.SetBasicAuth(user, password)
+	case auth.Bearer != nil:
+		var token string
+		if token, err = expandTemplate("auth.bearer.token", auth.Bearer.Token); err != nil {
+			break
+		}
+		t.request.Header.Set("Authorization", "Bearer "+token)
+	case auth.APIKey != nil:
+		var value string
+		if value, err = expandTemplate("auth.apiKey.value", auth.APIKey.Value); err != nil {
+			break
+		}
+		if auth.APIKey.Name == "" {
+			err = errors.New("auth.apiKey.name missing")
+			break
+		}
+		switch strings.ToLower(auth.APIKey.In) {
+		case "", "header":
+			t.request.Header.Set(auth.APIKey.Name, value)
+		case "query":
+			if t.request.URL.RawQuery != "" {
+				t.request.URL.RawQuery += "&"
+			}
+			t.request.URL.RawQuery += url.QueryEscape(auth.APIKey.Name) + "=" + url.QueryEscape(value)
+		default:
+			err = fmt.Errorf("auth.apiKey.in must be header or query, given %q", auth.APIKey.In)
+		}
+	case auth.OAuth2 != nil:
+		token := "<oauth2 token>"
+		if !t.offline {
+			if token, err = auth.OAuth2.token(t.client, false); err != nil {
+				// the test suite stops, it's not a failure of the test
+				t.setupErr = err
+				t.failed = true
+				return
+			}
+		}
+		t.request.Header.Set("Authorization", "Bearer "+token)
+	case auth.Digest != nil:
+		// the challenge is answered when the request is sent
+		t.digest = &digestAuth{}
+		if t.digest.User, err = expandTemplate("auth.digest.user", auth.Digest.User); err != nil {
+			break
+		}
+		t.digest.Password, err = expandTemplate("auth.digest.password", auth.Digest.Password)
+	}
+	if err != nil {
+		t.fail(err)
+	}
+}
+
+// maskedRequest returns the url and headers of the request with the
+// credentials masked, to be printed.
+func (t *Test) maskedRequest() (*url.URL, http.Header) {
+	u := *t.request.URL
+	if u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), mask)
+		}
+	}
+	h := t.requestHeader()
+	for _, k := range []string{"Authorization", "Proxy-Authorization"} {
+		if v := h.Get(k); v != "" {
+			if i := strings.Index(v, " "); i > 0 {
+				h.Set(k, v[:i+1]+mask)
+			} else {
+				h.Set(k, mask)
+			}
+		}
+	}
+	if auth := t.Request.Auth; auth != nil && auth.APIKey != nil && auth.APIKey.Name != "" {
+		if strings.ToLower(auth.APIKey.In) == "query" {
+			query := parseRawQuery(u.RawQuery)
+			for _, kv := range query {
+				if kv.Key == auth.APIKey.Name {
+					kv.raw = url.QueryEscape(kv.Key) + "=" + mask
+				}
+			}
+			u.RawQuery = query.encode()
+		} else if h.Get(auth.APIKey.Name) != "" {
+			h.Set(auth.APIKey.Name, mask)
+		}
+	}
+	return &u, h
+}
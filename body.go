@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// openBodyFile opens the body file of the request, a relative path is relative
+// to the tests file. The file is streamed unless it's a template, then it's
+// expanded in memory. The content type is detected from the file extension or
+// else from the content.
+func (t *Test) openBodyFile() (io.Reader, error) {
+	fp := t.relativePath(t.Request.BodyFile)
+	t.requestBodyFile = fp
+
+	f, err := os.Open(fp)
+	if err != nil {
+		return nil, err
+	}
+	fileInfo, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	t.requestBodySize = fileInfo.Size()
+
+	t.requestContentType = mime.TypeByExtension(filepath.Ext(fp))
+	if t.requestContentType == "" {
+		b := make([]byte, 512)
+		n, err := io.ReadFull(f, b)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			f.Close()
+			return nil, err
+		}
+		t.requestContentType = http.DetectContentType(b[:n])
+		if _, err := f.Seek(0, 0); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+
+	if !t.Request.BodyFileTemplate {
+		return f, nil
+	}
+	defer f.Close()
+	b := new(bytes.Buffer)
+	if _, err := b.ReadFrom(f); err != nil {
+		return nil, err
+	}
+	s, err := expandTemplate(fp, b.String())
+	if err != nil {
+		return nil, err
+	}
+	t.requestBody = []byte(s)
+	t.requestBodySize = int64(len(t.requestBody))
+	return bytes.NewBuffer(t.requestBody), nil
+}
+
+// reopenBodyFile opens the streamed body file again, it's the GetBody of the
+// request so the request can be sent again, like for digest authentication.
+func (t *Test) reopenBodyFile() (io.ReadCloser, error) {
+	return os.Open(t.requestBodyFile)
+}
+
+// relativePath returns the path relative to the directory of the tests file,
+// an absolute path is returned as is.
+func (t *Test) relativePath(fp string) string {
+	if filepath.IsAbs(fp) {
+		return fp
+	}
+	return filepath.Join(filepath.Dir(t.fp), fp)
+}
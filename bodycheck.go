@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+)
+
+// bodyExcerptSize is the number of bytes of the body which is shown in the
+// failure messages of the body assertions.
+const bodyExcerptSize = 200
+
+// evaluateBodyText checks bodyContains, bodyNotContains and bodyMatches, also
+// if bodyCheck is false. The named capture groups of bodyMatches are put in
+// the headerJar, so later requests can use them like response headers.
+func (t *Test) evaluateBodyText() {
+	for _, s := range t.Response.BodyContains {
+		if !bytes.Contains(t.Response.body, []byte(s)) {
+			t.fail(fmt.Errorf("expect response body to contain %q, given %s", s, bodyExcerpt(t.Response.body)))
+		}
+	}
+	for _, s := range t.Response.BodyNotContains {
+		if bytes.Contains(t.Response.body, []byte(s)) {
+			t.fail(fmt.Errorf("expect response body not to contain %q, given %s", s, bodyExcerpt(t.Response.body)))
+		}
+	}
+	for _, expr := range t.Response.BodyMatches {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			t.fail(fmt.Errorf("bodyMatches: %s", err))
+			continue
+		}
+		match := re.FindSubmatch(t.Response.body)
+		if match == nil {
+			t.fail(fmt.Errorf("expect response body to match %q, given %s", expr, bodyExcerpt(t.Response.body)))
+			continue
+		}
+		headerJarMu.Lock()
+		for i, name := range re.SubexpNames() {
+			if name != "" && match[i] != nil {
+				headerJar[name] = string(match[i])
+			}
+		}
+		headerJarMu.Unlock()
+	}
+}
+
+// bodyExcerpt returns the quoted start of the body.
+func bodyExcerpt(b []byte) string {
+	if len(b) <= bodyExcerptSize {
+		return fmt.Sprintf("%q", b)
+	}
+	return fmt.Sprintf("%q (%d bytes)", b[:bodyExcerptSize], len(b))
+}
@@ -1,27 +1,139 @@
 package main
 
 import (
-	"crypto/tls"
-
+	"encoding/json"
 	"net/http"
+	"sync"
 )
 
+// clientConfig holds everything which determines the http.Client of a
+// request, requests with the same configuration share a client and its
+// connections.
+type clientConfig struct {
+	InsecureSkipVerify bool              `json:"insecureSkipVerify"`
+	TLS                tlsConfig         `json:"tls"`   // absolute paths and expanded password
+	Proxy              *proxyConfig      `json:"proxy"` // expanded
+	UnixSocket         string            `json:"unixSocket"`
+	Resolve            map[string]string `json:"resolve"`
+	Protocol           string            `json:"protocol"`
+}
+
 var (
-	// this http client will verify TLS if used
-	httpClientTLSVerify = &http.Client{}
+	httpClients   = make(map[string]*http.Client)
+	httpClientsMu sync.Mutex
+)
 
-	// this http client will not verify TLS
-	httpClientSkipTLSVerify = &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		},
+// maxIdleConnsPerHost is the number of idle connections per host the clients
+// keep, a load test keeps one for every worker. 0 is the default of
+// http.Transport.
+var maxIdleConnsPerHost int
+
+// clientConfig returns the client configuration of the test, the TLS settings
+// which are not set and the proxy and unix socket if they're not set are taken
+// from the default test.
+func (t *Test) clientConfig(defaultTest *Test) (clientConfig, error) {
+	c := clientConfig{
+		InsecureSkipVerify: t.Request.TLSInsecureSkipVerify,
+		UnixSocket:         unixSocketPath(t.Request.UnixSocket),
+		Resolve:            resolveOverrides,
+		Protocol:           t.Request.Protocol,
 	}
-)
+	proxy := t.Request.Proxy
+	if defaultTest != nil && defaultTest.Request != nil {
+		if defaultTest.Request.TLS != nil {
+			defaultTest.Request.TLS.resolve(&c.TLS, defaultTest)
+		}
+		if proxy == nil {
+			proxy = defaultTest.Request.Proxy
+		}
+		if c.UnixSocket == "" {
+			c.UnixSocket = unixSocketPath(defaultTest.Request.UnixSocket)
+		}
+	}
+	if t.Request.TLS != nil {
+		t.Request.TLS.resolve(&c.TLS, t)
+	}
+	var err error
+	if c.TLS.PKCS12Password, err = expandTemplate("tls.pkcs12Password", c.TLS.PKCS12Password); err != nil {
+		return c, err
+	}
+	if proxy != nil {
+		if c.Proxy, err = proxy.expand(); err != nil {
+			return c, err
+		}
+	}
+	return c, nil
+}
 
-func Call(r *http.Request, InsecureSkipVerify bool) (*http.Response, error) {
-	if InsecureSkipVerify {
-		return httpClientSkipTLSVerify.Do(r)
-	} else {
-		return httpClientTLSVerify.Do(r)
+// prepareClient sets the http.Client the test is sent with, it shares the
+// transport of the cached client and has the redirect policy of the test.
+func (t *Test) prepareClient(defaultTest *Test) {
+	c, err := t.clientConfig(defaultTest)
+	if err != nil {
+		t.fail(err)
+		return
+	}
+	client, err := c.client()
+	if err != nil {
+		t.fail(err)
+		return
+	}
+	testClient := *client
+	testClient.CheckRedirect = t.checkRedirect
+	t.client = &testClient
+	t.clientCfg = &c
+}
+
+// client returns the cached client of the configuration, it's created on first
+// use.
+func (c clientConfig) client() (*http.Client, error) {
+	b, _ := json.Marshal(c)
+	key := string(b)
+	httpClientsMu.Lock()
+	defer httpClientsMu.Unlock()
+	if client, ok := httpClients[key]; ok {
+		return client, nil
+	}
+	tlsClientConfig, err := c.tlsClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	proxy, err := c.Proxy.proxyFunc()
+	if err != nil {
+		return nil, err
+	}
+	protocols, err := transportProtocols(c.Protocol)
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsClientConfig
+	transport.Proxy = proxy
+	transport.Protocols = protocols
+	if maxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = maxIdleConnsPerHost
+	}
+	if len(c.Resolve) > 0 {
+		transport.DialContext = resolveDialer(c.Resolve)
+	}
+	if c.UnixSocket != "" {
+		transport.Proxy = nil
+		transport.DialContext = unixSocketDialer(c.UnixSocket)
+	}
+	client := &http.Client{Transport: transport}
+	httpClients[key] = client
+	return client, nil
+}
+
+// Call sends the request with the client, if digest is set the request is
+// authenticated with HTTP Digest authentication. If trace is set the timings of
+// the request are recorded in it.
+func Call(r *http.Request, client *http.Client, digest *digestAuth, trace *requestTrace) (*http.Response, error) {
+	if trace != nil {
+		r = trace.withTrace(r)
+	}
+	if digest != nil {
+		return digest.do(client, r)
 	}
+	return client.Do(r)
 }
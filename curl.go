@@ -0,0 +1,535 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Curl returns a curl command line which sends the same request as the test.
+// The test must be prepared first.
+func (t *Test) Curl() string {
+	return t.curl(false)
+}
+
+// curl returns the curl command line, if masked is true the credentials are
+// masked.
+func (t *Test) curl(masked bool) string {
+	if t.request == nil {
+		return ""
+	}
+	u, header := t.request.URL, t.requestHeader()
+	if masked {
+		u, header = t.maskedRequest()
+	}
+	var buf bytes.Buffer
+	buf.WriteString("curl")
+	if t.Request.TLSInsecureSkipVerify {
+		buf.WriteString(" -k")
+	}
+	if c := t.clientCfg; c != nil {
+		buf.WriteString(curlTLS(&c.TLS, masked))
+		buf.WriteString(curlProxy(c.Proxy, masked))
+		if c.UnixSocket != "" {
+			buf.WriteString(" --unix-socket " + shellQuote(c.UnixSocket))
+		} else {
+			buf.WriteString(curlResolve(c.Resolve))
+		}
+	}
+	buf.WriteString(curlProtocol(t.Request.Protocol))
+	if t.Request.FollowRedirects == nil {
+		buf.WriteString(" -L")
+	} else if *t.Request.FollowRedirects > 0 {
+		buf.WriteString(fmt.Sprintf(" -L --max-redirs %d", *t.Request.FollowRedirects))
+	}
+	// curl keeps a method given with -X when it follows a 301, 302 or 303
+	// redirect, like Go it changes a POST to GET if the method is implied
+	hasBody := t.requestBody != nil || t.requestBodyFile != "" || t.isMultipart()
+	if m := t.request.Method; !(m == "GET" && !hasBody) && !(m == "POST" && hasBody) {
+		buf.WriteString(" -X ")
+		buf.WriteString(shellQuote(m))
+	}
+	if t.digest != nil {
+		password := t.digest.Password
+		if masked {
+			password = mask
+		}
+		buf.WriteString(" --digest -u ")
+		buf.WriteString(shellQuote(t.digest.User + ":" + password))
+	}
+	keys := make([]string, 0, len(header))
+	for k := range header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if k == "Content-Type" && t.isMultipart() {
+			// curl sets the content type with its own boundary
+			continue
+		}
+		for _, v := range header[k] {
+			buf.WriteString(" -H ")
+			if v == "" {
+				// curl removes a header given as "Key:", "Key;" sends it empty
+				buf.WriteString(shellQuote(k + ";"))
+			} else {
+				buf.WriteString(shellQuote(k + ": " + v))
+			}
+		}
+	}
+	if t.requestBody != nil {
+		buf.WriteString(" --data-raw ")
+		buf.WriteString(shellQuote(string(t.requestBody)))
+	} else if t.requestBodyFile != "" {
+		buf.WriteString(" --data-binary ")
+		buf.WriteString(shellQuote("@" + t.requestBodyFile))
+	} else if t.isMultipart() {
+		buf.WriteString(t.curlMultipart())
+	}
+	buf.WriteString(" ")
+	buf.WriteString(shellQuote(u.String()))
+	return buf.String()
+}
+
+// shellQuote quotes s for a POSIX shell, single quotes within s are escaped.
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./:=,+@%") == "" {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// curlArgFlags are the curl options which take an argument, the ones which
+// are not converted are skipped with their argument.
+var curlArgFlags = map[string]bool{
+	"-X": true, "--request": true,
+	"-H": true, "--header": true,
+	"-d": true, "--data": true, "--data-raw": true, "--data-binary": true, "--data-ascii": true, "--data-urlencode": true,
+	"-u": true, "--user": true,
+	"-b": true, "--cookie": true,
+	"-F": true, "--form": true, "--form-string": true,
+	"-A": true, "--user-agent": true,
+	"-e": true, "--referer": true,
+	"--url": true,
+	"-o":    true, "--output": true,
+	"-m": true, "--max-time": true, "--connect-timeout": true,
+	"-w": true, "--write-out": true,
+	"-x": true, "--proxy": true, "-U": true, "--proxy-user": true,
+	"-c": true, "--cookie-jar": true,
+	"-E": true, "--cert": true, "--key": true, "--cacert": true, "--capath": true,
+	"-r": true, "--range": true,
+	"-T": true, "--upload-file": true,
+	"--resolve": true, "--connect-to": true, "-K": true, "--config": true,
+	"--max-redirs": true, "--cert-type": true, "--key-type": true, "--pass": true, "--ciphers": true, "--tls-max": true,
+	"--retry": true, "--retry-delay": true, "--retry-max-time": true,
+	"--limit-rate": true, "--max-filesize": true, "-y": true, "--speed-time": true, "-Y": true, "--speed-limit": true,
+	"--proto": true, "--proto-redir": true, "--interface": true, "--local-port": true, "--dns-servers": true,
+	"--noproxy": true, "--proxy-header": true, "--socks5": true, "--socks5-hostname": true, "--preproxy": true,
+	"--unix-socket": true, "--keepalive-time": true, "--expect100-timeout": true,
+	"-z": true, "--time-cond": true, "-C": true, "--continue-at": true,
+	"-D": true, "--dump-header": true, "--trace": true, "--trace-ascii": true, "--stderr": true, "--output-dir": true,
+	"--oauth2-bearer": true, "--aws-sigv4": true, "--netrc-file": true,
+}
+
+// ImportCurl converts a curl command line into a test and appends it to the
+// tests file fp, the file is created if it doesn't exist. If args holds one
+// argument it's split like a shell would, "-" reads the command from stdin.
+func ImportCurl(args []string, fp, label string) error {
+	if len(args) == 1 {
+		command := args[0]
+		if command == "-" {
+			b, err := ioutil.ReadAll(os.Stdin)
+			if err != nil {
+				return err
+			}
+			command = string(b)
+		}
+		var err error
+		if args, err = shellSplit(command); err != nil {
+			return err
+		}
+	}
+	if len(args) > 0 && (args[0] == "curl" || strings.HasSuffix(args[0], "/curl")) {
+		args = args[1:]
+	}
+
+	t, err := parseCurl(args)
+	if err != nil {
+		return err
+	}
+	if label != "" {
+		t.Label = label
+	}
+
+	tests := make([]json.RawMessage, 0)
+	if b, err := ioutil.ReadFile(fp); err == nil {
+		if err := json.Unmarshal(b, &tests); err != nil {
+			return fmt.Errorf("%s: %s", fp, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	b, err := marshalJSON(t, "")
+	if err != nil {
+		return err
+	}
+	return writeJSONFile(fp, append(tests, b))
+}
+
+func parseCurl(args []string) (*testDef, error) {
+	var method, rawURL, cookie string
+	var data []string
+	var get, head bool
+	r := &requestDef{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			if rawURL != "" {
+				return nil, fmt.Errorf("curl command has more than one url, %q and %q, or an unknown option takes an argument", rawURL, arg)
+			}
+			rawURL = arg
+			continue
+		}
+		var value string
+		if strings.HasPrefix(arg, "--") {
+			if j := strings.Index(arg, "="); j > 0 && curlArgFlags[arg[:j]] {
+				arg, value = arg[:j], arg[j+1:]
+			} else if curlArgFlags[arg] {
+				if i++; i == len(args) {
+					return nil, fmt.Errorf("curl option %s requires an argument", arg)
+				}
+				value = args[i]
+			}
+		} else {
+			// short options can be combined like -sSL and a value can be
+			// attached like -XPOST
+			letters := arg[1:]
+			for len(letters) > 1 && !curlArgFlags["-"+letters[:1]] {
+				switch letters[0] {
+				case 'k':
+					r.TLSInsecureSkipVerify = true
+				case 'G':
+					get = true
+				case 'I':
+					head = true
+				}
+				letters = letters[1:]
+			}
+			arg = "-" + letters[:1]
+			if curlArgFlags[arg] {
+				if len(letters) > 1 {
+					value = letters[1:]
+				} else if i++; i == len(args) {
+					return nil, fmt.Errorf("curl option %s requires an argument", arg)
+				} else {
+					value = args[i]
+				}
+			}
+		}
+
+		switch arg {
+		case "-X", "--request":
+			method = value
+		case "--url":
+			if rawURL != "" {
+				return nil, fmt.Errorf("curl command has more than one url, %q and %q", rawURL, value)
+			}
+			rawURL = value
+		case "-H", "--header":
+			h := &headerDef{}
+			if j := strings.IndexAny(value, ":;"); j > 0 {
+				h.Key = strings.TrimSpace(value[:j])
+				h.Value = strings.TrimSpace(value[j+1:])
+				if value[j] == ':' && h.Value == "" {
+					// curl removes the header instead of sending it
+					continue
+				}
+			} else {
+				warn("invalid header %q not converted", value)
+				continue
+			}
+			r.Headers = append(r.Headers, h)
+		case "-A", "--user-agent":
+			r.Headers = append(r.Headers, &headerDef{Key: "User-Agent", Value: value})
+		case "-e", "--referer":
+			r.Headers = append(r.Headers, &headerDef{Key: "Referer", Value: value})
+		case "-d", "--data", "--data-ascii", "--data-binary", "--data-raw", "--data-urlencode":
+			if strings.HasPrefix(value, "@") && arg != "--data-raw" {
+				warn("%s %s reads a file, the file name is used as data", arg, value)
+			}
+			if arg == "-d" || arg == "--data" || arg == "--data-ascii" {
+				// curl strips carriage returns and newlines
+				value = strings.NewReplacer("\r", "", "\n", "").Replace(value)
+			}
+			if arg == "--data-urlencode" {
+				if j := strings.Index(value, "="); j >= 0 {
+					value = value[:j+1] + url.QueryEscape(value[j+1:])
+				} else {
+					value = url.QueryEscape(value)
+				}
+			}
+			data = append(data, value)
+		case "-u", "--user":
+			ui := &userInfoDef{User: value}
+			if j := strings.Index(value, ":"); j >= 0 {
+				ui.User, ui.Password = value[:j], value[j+1:]
+			}
+			r.URLUserInfo = ui
+		case "-b", "--cookie":
+			if !strings.Contains(value, "=") {
+				warn("cookie file %s not converted", value)
+				continue
+			}
+			if cookie != "" {
+				cookie += "; "
+			}
+			cookie += value
+		case "-F", "--form":
+			if p := parseCurlForm(value); p != nil {
+				r.BodyMultipart = append(r.BodyMultipart, p)
+			}
+		case "--form-string":
+			j := strings.Index(value, "=")
+			if j < 0 {
+				warn("invalid form field %q not converted", value)
+				continue
+			}
+			r.BodyMultipart = append(r.BodyMultipart, &multipartPart{Name: value[:j], Value: value[j+1:]})
+		case "-k", "--insecure":
+			r.TLSInsecureSkipVerify = true
+		case "-G", "--get":
+			get = true
+		case "-I", "--head":
+			head = true
+		default:
+			if value != "" {
+				warn("curl option %s %s ignored", arg, value)
+			}
+		}
+	}
+
+	if rawURL == "" {
+		return nil, errors.New("curl command has no url")
+	}
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "http://" + rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	body := strings.Join(data, "&")
+	if get && body != "" {
+		if u.RawQuery != "" {
+			u.RawQuery += "&"
+		}
+		u.RawQuery += body
+		body = ""
+	}
+	if method == "" {
+		switch {
+		case head:
+			method = "HEAD"
+		case body != "" || r.BodyMultipart != nil:
+			method = "POST"
+		default:
+			method = "GET"
+		}
+	}
+
+	t := &testDef{Label: method + " " + u.RequestURI()}
+	ui, insecure := r.URLUserInfo, r.TLSInsecureSkipVerify
+	t.Request = newRequestDef(method, u)
+	if ui != nil {
+		t.Request.URLUserInfo = ui
+	}
+	t.Request.TLSInsecureSkipVerify = insecure
+	t.Request.Headers = r.Headers
+	if cookie != "" {
+		t.Request.Headers = append(t.Request.Headers, &headerDef{Key: "Cookie", Value: cookie})
+	}
+	if r.BodyMultipart != nil {
+		t.Request.BodyMultipart = r.BodyMultipart
+	} else if body != "" {
+		if !t.hasRequestHeader("Content-Type") {
+			// curl sends data as a form by default
+			t.Request.Headers = append(t.Request.Headers, &headerDef{Key: "Content-Type", Value: "application/x-www-form-urlencoded"})
+		}
+		if v, ok := jsonBody(body); ok && strings.Contains(t.requestHeader("Content-Type"), "json") {
+			t.Request.BodyJson = v
+		} else {
+			t.Request.BodyString = body
+		}
+	}
+	return t, nil
+}
+
+// parseCurlForm converts a -F value like name=value or
+// name=@file;type=text/plain;filename=name.txt into a multipart part.
+func parseCurlForm(value string) *multipartPart {
+	j := strings.Index(value, "=")
+	if j < 0 {
+		warn("invalid form field %q not converted", value)
+		return nil
+	}
+	p := &multipartPart{Name: value[:j]}
+	value = value[j+1:]
+	if strings.HasPrefix(value, "<") {
+		warn("form field %s reads its value from a file, not converted", p.Name)
+		return nil
+	}
+	isFile := strings.HasPrefix(value, "@")
+	params := strings.Split(strings.TrimPrefix(value, "@"), ";")
+	value = strings.Trim(params[0], `"`)
+	for _, param := range params[1:] {
+		switch {
+		case strings.HasPrefix(param, "type="):
+			p.ContentType = strings.Trim(param[len("type="):], `"`)
+		case strings.HasPrefix(param, "filename="):
+			p.Filename = strings.Trim(param[len("filename="):], `"`)
+		}
+	}
+	switch {
+	case isFile:
+		p.File = value
+	case p.Filename != "":
+		p.Content = value
+	default:
+		p.Value = value
+	}
+	return p
+}
+
+// shellSplit splits a command line into arguments like a POSIX shell, it
+// supports quotes, $'...' strings and escaped newlines.
+func shellSplit(s string) ([]string, error) {
+	args := make([]string, 0)
+	var arg bytes.Buffer
+	inArg := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\':
+			if i++; i < len(s) && s[i] != '\n' {
+				arg.WriteByte(s[i])
+				inArg = true
+			}
+		case c == '\'':
+			j := strings.IndexByte(s[i+1:], '\'')
+			if j < 0 {
+				return nil, errors.New("unterminated single quote")
+			}
+			arg.WriteString(s[i+1 : i+1+j])
+			i += j + 1
+			inArg = true
+		case c == '$' && i+1 < len(s) && s[i+1] == '\'':
+			i += 2
+			for ; i < len(s) && s[i] != '\''; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+					switch s[i] {
+					case 'n':
+						arg.WriteByte('\n')
+					case 'r':
+						arg.WriteByte('\r')
+					case 't':
+						arg.WriteByte('\t')
+					default:
+						arg.WriteByte(s[i])
+					}
+				} else {
+					arg.WriteByte(s[i])
+				}
+			}
+			if i == len(s) {
+				return nil, errors.New("unterminated $' quote")
+			}
+			inArg = true
+		case c == '"':
+			for i++; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) && strings.IndexByte("$`\"\\\n", s[i+1]) >= 0 {
+					i++
+					if s[i] == '\n' {
+						continue
+					}
+				}
+				arg.WriteByte(s[i])
+			}
+			if i == len(s) {
+				return nil, errors.New("unterminated double quote")
+			}
+			inArg = true
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteByte(c)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+// curlTLS returns the curl options of the TLS settings, curl can't set the
+// server name.
+func curlTLS(c *tlsConfig, masked bool) string {
+	var buf bytes.Buffer
+	if c.CAFile != "" {
+		buf.WriteString(" --cacert " + shellQuote(c.CAFile))
+	}
+	if c.CertFile != "" {
+		buf.WriteString(" --cert " + shellQuote(c.CertFile))
+		if c.KeyFile != "" {
+			buf.WriteString(" --key " + shellQuote(c.KeyFile))
+		}
+	} else if c.PKCS12File != "" {
+		password := c.PKCS12Password
+		if masked && password != "" {
+			password = mask
+		}
+		buf.WriteString(" --cert-type P12 --cert " + shellQuote(c.PKCS12File+":"+password))
+	}
+	if c.MinVersion != "" {
+		buf.WriteString(" --tlsv" + c.MinVersion)
+	}
+	if c.MaxVersion != "" {
+		buf.WriteString(" --tls-max " + c.MaxVersion)
+	}
+	return buf.String()
+}
+
+// curlProxy returns the curl options of the proxy settings, without settings
+// curl uses the environment variables too.
+func curlProxy(p *proxyConfig, masked bool) string {
+	if p == nil || (p.URL == "" && !p.Disabled) {
+		return ""
+	}
+	if p.Disabled {
+		return " --noproxy '*'"
+	}
+	var buf bytes.Buffer
+	buf.WriteString(" -x " + shellQuote(p.URL))
+	if p.User != "" {
+		password := p.Password
+		if masked {
+			password = mask
+		}
+		buf.WriteString(" --proxy-user " + shellQuote(p.User+":"+password))
+	}
+	if len(p.NoProxy) > 0 {
+		buf.WriteString(" --noproxy " + shellQuote(strings.Join(p.NoProxy, ",")))
+	}
+	return buf.String()
+}
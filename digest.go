@@ -0,0 +1,237 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// digestAuth holds the expanded credentials of the HTTP Digest
+// authentication, see RFC 7616.
+type digestAuth struct {
+	User     string `json:"user"`
+	Password string `json:"password"`
+}
+
+type digestChallenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	qop       string // auth or empty for RFC 2069 servers
+	stale     bool
+	nc        int // the number of requests sent with the nonce
+}
+
+// digestChallenges caches the last challenge of every server, so following
+// requests to the same realm are authenticated without another 401 response
+// and the nonce count is increased.
+var digestChallenges = make(map[string]*digestChallenge)
+
+// digestMu guards the challenges and their nonce counts.
+var digestMu sync.Mutex
+
+// digestAlgorithms lists the supported algorithms in order of preference.
+var digestAlgorithms = map[string]int{
+	"SHA-256-SESS": 4,
+	"SHA-256":      3,
+	"MD5-SESS":     2,
+	"MD5":          1,
+}
+
+// do sends the request, with the cached challenge of the server if there is
+// one. If the server answers with a digest challenge the request is sent once
+// more with the response to the challenge.
+func (a *digestAuth) do(client *http.Client, r *http.Request) (*http.Response, error) {
+	space := r.URL.Scheme + "://" + r.URL.Host
+	req := r
+	digestMu.Lock()
+	c := digestChallenges[space]
+	digestMu.Unlock()
+	if c != nil {
+		var err error
+		if req, err = a.authorize(r, c); err != nil {
+			return nil, err
+		}
+	}
+	resp, err := client.Do(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	c, err = parseDigestChallenge(resp.Header.Values("WWW-Authenticate"))
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if c == nil {
+		// not a digest challenge, the test checks the response
+		return resp, nil
+	}
+	if r.Body != nil && r.Body != http.NoBody && r.GetBody == nil {
+		resp.Body.Close()
+		return nil, errors.New("digest authentication: the request body cannot be sent a second time, send a request without body to the realm first")
+	}
+	ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	digestMu.Lock()
+	digestChallenges[space] = c
+	digestMu.Unlock()
+	if req, err = a.authorize(r, c); err != nil {
+		return nil, err
+	}
+	if r.GetBody != nil {
+		if req.Body, err = r.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	return client.Do(req)
+}
+
+// authorize returns a copy of the request with the Authorization header which
+// answers the challenge.
+func (a *digestAuth) authorize(r *http.Request, c *digestChallenge) (*http.Request, error) {
+	b := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return nil, err
+	}
+	cnonce := hex.EncodeToString(b)
+	digestMu.Lock()
+	c.nc++
+	nc := fmt.Sprintf("%08x", c.nc)
+	digestMu.Unlock()
+	uri := r.URL.RequestURI()
+
+	var h func() hash.Hash = md5.New
+	if strings.HasPrefix(c.algorithm, "SHA-256") {
+		h = sha256.New
+	}
+	ha1 := digestHash(h, a.User+":"+c.realm+":"+a.Password)
+	if strings.HasSuffix(c.algorithm, "-SESS") {
+		ha1 = digestHash(h, ha1+":"+c.nonce+":"+cnonce)
+	}
+	ha2 := digestHash(h, r.Method+":"+uri)
+
+	var response string
+	if c.qop == "" {
+		response = digestHash(h, ha1+":"+c.nonce+":"+ha2)
+	} else {
+		response = digestHash(h, strings.Join([]string{ha1, c.nonce, nc, cnonce, c.qop, ha2}, ":"))
+	}
+
+	params := []string{
+		fmt.Sprintf(`username="%s"`, quoteEscaper.Replace(a.User)),
+		fmt.Sprintf(`realm="%s"`, quoteEscaper.Replace(c.realm)),
+		fmt.Sprintf(`nonce="%s"`, quoteEscaper.Replace(c.nonce)),
+		fmt.Sprintf(`uri="%s"`, quoteEscaper.Replace(uri)),
+		"algorithm=" + c.algorithm,
+		fmt.Sprintf(`response="%s"`, response),
+	}
+	if c.qop != "" {
+		params = append(params, "qop="+c.qop, "nc="+nc, fmt.Sprintf(`cnonce="%s"`, cnonce))
+	}
+	if c.opaque != "" {
+		params = append(params, fmt.Sprintf(`opaque="%s"`, quoteEscaper.Replace(c.opaque)))
+	}
+	req := r.Clone(r.Context())
+	req.Header.Set("Authorization", "Digest "+strings.Join(params, ", "))
+	return req, nil
+}
+
+func digestHash(h func() hash.Hash, s string) string {
+	d := h()
+	io.WriteString(d, s)
+	return hex.EncodeToString(d.Sum(nil))
+}
+
+// parseDigestChallenge returns the digest challenge with the most preferred
+// algorithm of the WWW-Authenticate headers, or nil if the server didn't send
+// a digest challenge.
+func parseDigestChallenge(values []string) (*digestChallenge, error) {
+	var best *digestChallenge
+	var unsupported string
+	for _, v := range values {
+		if len(v) < 7 || !strings.EqualFold(v[:7], "Digest ") {
+			continue
+		}
+		params := parseAuthParams(v[7:])
+		c := &digestChallenge{
+			realm:     params["realm"],
+			nonce:     params["nonce"],
+			opaque:    params["opaque"],
+			algorithm: strings.ToUpper(params["algorithm"]),
+			stale:     strings.EqualFold(params["stale"], "true"),
+		}
+		if c.algorithm == "" {
+			c.algorithm = "MD5"
+		}
+		if digestAlgorithms[c.algorithm] == 0 {
+			unsupported = "algorithm " + params["algorithm"]
+			continue
+		}
+		if qop, ok := params["qop"]; ok {
+			for _, q := range strings.Split(qop, ",") {
+				if strings.TrimSpace(q) == "auth" {
+					c.qop = "auth"
+				}
+			}
+			if c.qop == "" {
+				unsupported = "qop " + qop
+				continue
+			}
+		}
+		if best == nil || digestAlgorithms[c.algorithm] > digestAlgorithms[best.algorithm] {
+			best = c
+		}
+	}
+	if best == nil && unsupported != "" {
+		return nil, fmt.Errorf("digest authentication: unsupported %s", unsupported)
+	}
+	return best, nil
+}
+
+// parseAuthParams parses the comma separated name=value pairs of a challenge,
+// values can be quoted strings.
+func parseAuthParams(s string) map[string]string {
+	params := make(map[string]string)
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		i := strings.Index(s, "=")
+		if i < 0 {
+			return params
+		}
+		name := strings.ToLower(strings.TrimSpace(s[:i]))
+		s = strings.TrimLeft(s[i+1:], " \t")
+		var value strings.Builder
+		if strings.HasPrefix(s, `"`) {
+			j := 1
+			for ; j < len(s) && s[j] != '"'; j++ {
+				if s[j] == '\\' && j+1 < len(s) {
+					j++
+				}
+				value.WriteByte(s[j])
+			}
+			if j < len(s) {
+				j++
+			}
+			s = s[j:]
+		} else {
+			j := strings.IndexByte(s, ',')
+			if j < 0 {
+				j = len(s)
+			}
+			value.WriteString(strings.TrimSpace(s[:j]))
+			s = s[j:]
+		}
+		params[name] = value.String()
+	}
+}
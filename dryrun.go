@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+)
+
+// planEntry describes the request a test would send after the default test
+// has been merged into it.
+type planEntry struct {
+	Label   string      `json:"label"`
+	File    string      `json:"file"`
+	Method  string      `json:"method"`
+	URL     string      `json:"url"`
+	Socket  string      `json:"unixSocket,omitempty"`
+	Headers http.Header `json:"headers"`
+	Curl    string      `json:"curl,omitempty"`
+	Errors  []string    `json:"errors,omitempty"`
+}
+
+// DryRun prepares all tests in execution order and prints the resolved
+// requests without performing any network I/O.
+func (ts *TestSuite) DryRun(jsonOutput bool) error {
+	tests, err := ts.prepareAll(jsonOutput)
+	if err != nil {
+		return err
+	}
+	plan := make([]*planEntry, 0, len(tests))
+	for _, t := range tests {
+		plan = append(plan, newPlanEntry(t))
+		t.closeRequestBody()
+	}
+	if jsonOutput {
+		b, err := marshalJSON(plan, "  ")
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(b)
+		return err
+	}
+	for _, p := range plan {
+		p.print()
+	}
+	return nil
+}
+
+// prepareAll prepares the default test and all tests in execution order
+// without running them.
+func (ts *TestSuite) prepareAll(quiet bool) ([]*Test, error) {
+	tests, err := GetTests(ts.fp, ts.Includes)
+	if err != nil {
+		return nil, err
+	}
+	if ts.Default != nil {
+		ts.Default.quiet = quiet
+		ts.Default.offline = true
+		ts.Default.Prepare(nil)
+	}
+	all := make([]*Test, 0, len(ts.First)+len(tests)+len(ts.Last))
+	all = append(all, ts.First...)
+	all = append(all, tests...)
+	all = append(all, ts.Last...)
+	for _, t := range all {
+		t.quiet = quiet
+		t.offline = true
+		t.Prepare(ts.Default)
+	}
+	return all, nil
+}
+
+func newPlanEntry(t *Test) *planEntry {
+	p := &planEntry{Label: t.Label, File: t.fp, Headers: http.Header{}}
+	if t.request != nil {
+		p.Method = t.request.Method
+		u, header := t.maskedRequest()
+		p.URL = u.String()
+		p.Headers = header
+		p.Socket = unixSocketPath(t.Request.UnixSocket)
+		p.Curl = t.curl(true)
+	} else if t.Request != nil {
+		p.Method = t.Request.Method
+		if t.Request.URL != nil {
+			p.URL = t.Request.URL.Redacted()
+		}
+	}
+	for _, err := range t.errs {
+		p.Errors = append(p.Errors, err.Error())
+	}
+	return p
+}
+
+func (p *planEntry) print() {
+	fmt.Printf("\033[1;37m%s\033[0m (%s)\n", p.Label, p.File)
+	fmt.Printf("  \033[1;33m%s\033[0m %s\n", p.Method, p.URL)
+	if p.Socket != "" {
+		fmt.Printf("  \033[1;33mUnix socket\033[0m: %s\n", p.Socket)
+	}
+	keys := make([]string, 0, len(p.Headers))
+	for k := range p.Headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range p.Headers[k] {
+			fmt.Printf("  \033[1;33m%s\033[0m: %s\n", k, v)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// duration is a duration in JSON given as string like "500ms" or "1.5s", or
+// as number of milliseconds.
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(b), []byte(`"`)) {
+		var s string
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+		v, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("duration %q: %s", s, err)
+		}
+		*d = duration(v)
+		return nil
+	}
+	var ms float64
+	if err := json.Unmarshal(b, &ms); err != nil {
+		return fmt.Errorf("duration must be a string like \"500ms\" or a number of milliseconds, given %s", b)
+	}
+	*d = duration(ms * float64(time.Millisecond))
+	return nil
+}
+
+// prepareMaxDuration sets the maximum duration of the test, the one of the
+// default test is used if the test doesn't set one. It's checked also if the
+// test has no response assertions.
+func (t *Test) prepareMaxDuration(defaultTest *Test) {
+	if t.Response != nil && t.Response.MaxDuration != nil {
+		t.maxDuration = time.Duration(*t.Response.MaxDuration)
+	} else if defaultTest != nil && defaultTest.Response != nil && defaultTest.Response.MaxDuration != nil {
+		t.maxDuration = time.Duration(*defaultTest.Response.MaxDuration)
+	}
+}
+
+func (t *Test) evaluateDuration() {
+	if t.maxDuration <= 0 {
+		return
+	}
+	if given := t.trace.duration("total"); given > t.maxDuration {
+		t.fail(fmt.Errorf("expect duration to be at most %s, given %s", t.maxDuration, given.Round(time.Microsecond)))
+	}
+}
+
+// printSlowest prints the n slowest tests which received a response.
+func (ts *TestSuite) printSlowest(n int) {
+	results := make([]*testResult, 0, len(ts.results))
+	for _, r := range ts.results {
+		if r.Timings != nil && r.StatusCode != 0 {
+			results = append(results, r)
+		}
+	}
+	if n <= 0 || len(results) == 0 {
+		return
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Timings.duration("total") > results[j].Timings.duration("total")
+	})
+	if len(results) > n {
+		results = results[:n]
+	}
+	fmt.Printf("\033[1;37mSlowest %d tests\033[0m\n", len(results))
+	for _, r := range results {
+		color := "0;37"
+		if !r.Passed {
+			color = "0;31"
+		}
+		fmt.Printf("  %10s \033[%sm%s\033[0m (%s)\n", r.Timings.duration("total").Round(time.Microsecond), color, r.Label, r.File)
+	}
+}
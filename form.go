@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// keyValues is an ordered list of key value pairs, keys can be repeated. In
+// JSON it's a list of {"key":"k","value":"v"} objects or an object, the order
+// of the object is kept and a list value repeats the key for every value.
+type keyValues []*keyValue
+
+type keyValue struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	raw   string // the url encoded pair
+}
+
+func (kvs *keyValues) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+	if len(b) > 0 && b[0] == '[' {
+		list := make([]*keyValue, 0)
+		if err := json.Unmarshal(b, &list); err != nil {
+			return err
+		}
+		*kvs = list
+		return nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if tok, err := dec.Token(); err != nil {
+		return err
+	} else if tok == nil {
+		*kvs = nil
+		return nil
+	} else if tok != json.Delim('{') {
+		return errors.New("key values must be an object or a list")
+	}
+	list := make([]*keyValue, 0)
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key := tok.(string)
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			return err
+		}
+		values, ok := v.([]interface{})
+		if !ok {
+			values = []interface{}{v}
+		}
+		for _, value := range values {
+			if _, ok := value.(map[string]interface{}); ok {
+				return fmt.Errorf("value of %s must be a string, number, boolean or list", key)
+			}
+			s := ""
+			if value != nil {
+				s = fmt.Sprint(value)
+			}
+			list = append(list, &keyValue{Key: key, Value: s})
+		}
+	}
+	*kvs = list
+	return nil
+}
+
+// encode returns the url encoded pairs in order.
+func (kvs keyValues) encode() string {
+	pairs := make([]string, 0, len(kvs))
+	for _, kv := range kvs {
+		pairs = append(pairs, kv.encode())
+	}
+	return strings.Join(pairs, "&")
+}
+
+func (kv *keyValue) encode() string {
+	if kv.raw != "" {
+		return kv.raw
+	}
+	return url.QueryEscape(kv.Key) + "=" + url.QueryEscape(kv.Value)
+}
+
+// parseRawQuery splits a raw query into pairs, the encoding of every pair is
+// kept as is.
+func parseRawQuery(rawQuery string) keyValues {
+	kvs := make(keyValues, 0)
+	for _, pair := range strings.Split(rawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		key := pair
+		if i := strings.Index(pair, "="); i >= 0 {
+			key = pair[:i]
+		}
+		if k, err := url.QueryUnescape(key); err == nil {
+			key = k
+		}
+		kvs = append(kvs, &keyValue{Key: key, raw: pair})
+	}
+	return kvs
+}
+
+// prepareOwnQuery keeps the query parameters of the test itself, the url
+// rawQuery followed by the query list, before the default test is merged into
+// the url.
+func (t *Test) prepareOwnQuery() {
+	if t.query != nil {
+		return
+	}
+	t.query = make(keyValues, 0)
+	if t.Request.URL != nil {
+		t.query = append(t.query, parseRawQuery(t.Request.URL.RawQuery)...)
+	}
+	t.query = append(t.query, t.Request.Query...)
+}
+
+// ownQuery returns the query parameters of the test itself, they're kept when
+// the test is prepared. The default test is shared by concurrent tests, so
+// they're only read.
+func (t *Test) ownQuery() keyValues {
+	return t.query
+}
+
+// prepareQuery sets the rawQuery of the url to the query parameters of the
+// test followed by the query parameters of the default test which keys are
+// not used by the test.
+func (t *Test) prepareQuery(defaultTest *Test) {
+	query := append(keyValues{}, t.ownQuery()...)
+	if !t.Request.NoDefaultQuery && defaultTest != nil && defaultTest != t && defaultTest.Request != nil {
+		keys := make(map[string]bool)
+		for _, kv := range query {
+			keys[kv.Key] = true
+		}
+		for _, kv := range defaultTest.ownQuery() {
+			if !keys[kv.Key] {
+				query = append(query, kv)
+			}
+		}
+	}
+	t.Request.URL.RawQuery = query.encode()
+}
+
+// isForm reports whether the request body is an url encoded form, the other
+// body properties preceed above bodyForm.
+func (t *Test) isForm() bool {
+	return t.Request.BodyString == "" && t.Request.BodyJson == nil && t.Request.BodyFile == "" && t.Request.BodyMultipart == nil && t.Request.BodyForm != nil
+}
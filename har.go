@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// A HTTP Archive (HAR) 1.2 file, only the properties which can be converted
+// to tests are read.
+type harFile struct {
+	Log struct {
+		Entries []*harEntry `json:"entries"`
+	} `json:"log"`
+}
+
+type harEntry struct {
+	Request struct {
+		Method   string          `json:"method"`
+		URL      string          `json:"url"`
+		Headers  []*harNameValue `json:"headers"`
+		PostData *struct {
+			MimeType string          `json:"mimeType"`
+			Text     string          `json:"text"`
+			Params   []*harNameValue `json:"params"`
+		} `json:"postData"`
+	} `json:"request"`
+	Response struct {
+		Status  int `json:"status"`
+		Content struct {
+			MimeType string `json:"mimeType"`
+			Text     string `json:"text"`
+			Encoding string `json:"encoding"`
+		} `json:"content"`
+	} `json:"response"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// harNoiseHeaders are request headers which are set by the browser or the
+// HTTP client and are not part of the request under test.
+var harNoiseHeaders = map[string]bool{
+	"accept-encoding":           true,
+	"accept-language":           true,
+	"cache-control":             true,
+	"connection":                true,
+	"content-length":            true,
+	"cookie":                    true,
+	"dnt":                       true,
+	"host":                      true,
+	"origin":                    true,
+	"pragma":                    true,
+	"priority":                  true,
+	"referer":                   true,
+	"te":                        true,
+	"upgrade-insecure-requests": true,
+	"user-agent":                true,
+}
+
+// ImportHAR converts the entries of a HAR file into a tests file and writes a
+// test suite which has the most used scheme and host as default. The cookies
+// recorded in the HAR file are dropped, the test suite uses the cookie jar
+// instead. If snapshot is true the recorded response body is checked.
+func ImportHAR(fp, dir string, snapshot bool) error {
+	b, err := ioutil.ReadFile(fp)
+	if err != nil {
+		return err
+	}
+	h := &harFile{}
+	if err := json.Unmarshal(b, h); err != nil {
+		return fmt.Errorf("%s: %s", fp, err)
+	}
+
+	tests := make([]*testDef, 0, len(h.Log.Entries))
+	hosts := make(map[string]int)
+	for i, e := range h.Log.Entries {
+		u, err := url.Parse(e.Request.URL)
+		if err != nil || u.Host == "" {
+			warn("entry %d: skipped, invalid url %q", i+1, e.Request.URL)
+			continue
+		}
+		t := &testDef{
+			Label:   e.Request.Method + " " + u.RequestURI(),
+			Request: newRequestDef(e.Request.Method, u),
+		}
+		hosts[u.Scheme+"://"+u.Host]++
+		for _, hdr := range e.Request.Headers {
+			name := strings.ToLower(hdr.Name)
+			if harNoiseHeaders[name] || strings.HasPrefix(name, "sec-") || strings.HasPrefix(name, ":") {
+				continue
+			}
+			t.Request.Headers = append(t.Request.Headers, &headerDef{Key: hdr.Name, Value: hdr.Value})
+		}
+		if pd := e.Request.PostData; pd != nil {
+			text := pd.Text
+			if text == "" && len(pd.Params) > 0 {
+				params := make([]string, 0, len(pd.Params))
+				for _, p := range pd.Params {
+					params = append(params, url.QueryEscape(p.Name)+"="+url.QueryEscape(p.Value))
+				}
+				text = strings.Join(params, "&")
+			}
+			if v, ok := jsonBody(text); ok && strings.Contains(pd.MimeType, "json") {
+				t.Request.BodyJson = v
+			} else {
+				t.Request.BodyString = text
+			}
+			if pd.MimeType != "" && !t.hasRequestHeader("Content-Type") {
+				t.Request.Headers = append(t.Request.Headers, &headerDef{Key: "Content-Type", Value: pd.MimeType})
+			}
+		}
+		if e.Response.Status > 0 {
+			t.Response = &responseDef{StatusCode: e.Response.Status}
+			if snapshot {
+				harSnapshot(t, e)
+			}
+		}
+		tests = append(tests, t)
+	}
+
+	// factor the most used host into the default test
+	common, max := "", 0
+	for host, n := range hosts {
+		if n > max || (n == max && host < common) {
+			common, max = host, n
+		}
+	}
+	ts := &testSuiteDef{Includes: []string{"tests.json"}}
+	if common != "" {
+		u, _ := url.Parse(common)
+		ts.Default = &testDef{
+			Request:      &requestDef{URL: &urlDef{Scheme: u.Scheme, Host: u.Host}},
+			UseCookieJar: true,
+		}
+		for _, t := range tests {
+			if t.Request.URL.Scheme+"://"+t.Request.URL.Host == common {
+				t.Request.URL.Scheme = ""
+				t.Request.URL.Host = ""
+			}
+		}
+	}
+	if err := writeJSONFile(filepath.Join(dir, "tests.json"), tests); err != nil {
+		return err
+	}
+	return writeJSONFile(filepath.Join(dir, "testsuite.json"), ts)
+}
+
+// harSnapshot checks the response body against the recorded response body.
+func harSnapshot(t *testDef, e *harEntry) {
+	text := e.Response.Content.Text
+	if e.Response.Content.Encoding == "base64" {
+		b, err := base64.StdEncoding.DecodeString(text)
+		if err != nil || !utf8.Valid(b) {
+			warn("%s: binary response body not added to the snapshot", t.Label)
+			return
+		}
+		text = string(b)
+	}
+	if text == "" {
+		return
+	}
+	t.Response.BodyCheck = true
+	t.Response.BodyString = text
+}
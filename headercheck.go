@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// headerMatchers compare a header value with the value of the test case.
+var headerMatchers = map[string]struct {
+	verb  string // used in the failure message
+	match func(given, expected string) (bool, error)
+}{
+	"equals": {"equal", func(given, expected string) (bool, error) {
+		return given == expected, nil
+	}},
+	"prefix": {"start with", func(given, expected string) (bool, error) {
+		return strings.HasPrefix(given, expected), nil
+	}},
+	"contains": {"contain", func(given, expected string) (bool, error) {
+		return strings.Contains(given, expected), nil
+	}},
+	"regex": {"match", func(given, expected string) (bool, error) {
+		return regexp.MatchString(expected, given)
+	}},
+}
+
+// validates reports whether the header is checked, a match mode implies
+// validate.
+func (c *responseHeaderTestCase) validates() bool {
+	return c.Validate || c.Match != ""
+}
+
+// evaluateHeader checks the values of the header, the header name is case
+// insensitive. Unless all is true one of the values must match.
+func (t *Test) evaluateHeader(c *responseHeaderTestCase) {
+	key := http.CanonicalHeaderKey(c.Key)
+	values := t.response.Header.Values(key)
+	switch c.Match {
+	case "absent":
+		if len(values) > 0 {
+			t.fail(fmt.Errorf("expected header %s to be absent, given %s", key, headerValues(values)))
+		}
+		return
+	case "count":
+		n, err := strconv.Atoi(c.Value)
+		if err != nil {
+			t.fail(fmt.Errorf("header %s: the value of match count must be a number, given %q", key, c.Value))
+		} else if n != len(values) {
+			t.fail(fmt.Errorf("expected header %s %d times, given %d times", key, n, len(values)))
+		}
+		return
+	}
+	matchMode := c.Match
+	if matchMode == "" {
+		matchMode = "equals"
+	}
+	m, ok := headerMatchers[matchMode]
+	if !ok {
+		t.fail(fmt.Errorf("header %s: match must be equals, prefix, contains, regex, absent or count, given %q", key, c.Match))
+		return
+	}
+	if len(values) == 0 {
+		t.fail(fmt.Errorf("expected header %s to be present", key))
+		return
+	}
+	matched := 0
+	for _, v := range values {
+		ok, err := m.match(v, c.Value)
+		if err != nil {
+			t.fail(fmt.Errorf("header %s: %s", key, err))
+			return
+		}
+		if ok {
+			matched++
+		}
+	}
+	if c.All && matched < len(values) {
+		t.fail(fmt.Errorf("expected every value of header %s to %s %s, given %s", key, m.verb, c.Value, headerValues(values)))
+	} else if matched == 0 {
+		t.fail(fmt.Errorf("expected header %s to %s %s, given %s", key, m.verb, c.Value, headerValues(values)))
+	}
+}
+
+// headerValues formats the values of a header for a failure message, a single
+// value as it is.
+func headerValues(values []string) string {
+	if len(values) == 1 {
+		return values[0]
+	}
+	return fmt.Sprintf("%q", values)
+}
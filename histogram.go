@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"sort"
+	"strings"
+	"time"
+)
+
+// histogramSubBuckets is the number of buckets per power of two, like a HDR
+// histogram the values are exact below 2*histogramSubBuckets microseconds and
+// above the relative error is less than 1/histogramSubBuckets.
+const histogramSubBuckets = 64
+
+// histogram records durations in microseconds in log-linear buckets.
+type histogram struct {
+	counts map[int64]int64 // by the lowest value of the bucket
+	count  int64
+	min    int64
+	max    int64
+	sum    int64
+}
+
+func newHistogram() *histogram {
+	return &histogram{counts: make(map[int64]int64)}
+}
+
+// histogramBucket returns the lowest value of the bucket of v.
+func histogramBucket(v int64) int64 {
+	if v < 2*histogramSubBuckets {
+		return v
+	}
+	shift := uint(bits.Len64(uint64(v)) - bits.Len64(2*histogramSubBuckets-1))
+	return v >> shift << shift
+}
+
+// histogramBucketEnd returns the lowest value of the next bucket.
+func histogramBucketEnd(bucket int64) int64 {
+	if bucket < 2*histogramSubBuckets {
+		return bucket + 1
+	}
+	shift := uint(bits.Len64(uint64(bucket)) - bits.Len64(2*histogramSubBuckets-1))
+	return bucket + 1<<shift
+}
+
+func (h *histogram) record(d time.Duration) {
+	v := d.Microseconds()
+	if v < 0 {
+		v = 0
+	}
+	h.counts[histogramBucket(v)]++
+	if h.count == 0 || v < h.min {
+		h.min = v
+	}
+	if v > h.max {
+		h.max = v
+	}
+	h.count++
+	h.sum += v
+}
+
+func (h *histogram) buckets() []int64 {
+	buckets := make([]int64, 0, len(h.counts))
+	for b := range h.counts {
+		buckets = append(buckets, b)
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i] < buckets[j] })
+	return buckets
+}
+
+// percentile returns the highest value of the bucket the percentile is in.
+func (h *histogram) percentile(p float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	target := int64(math.Ceil(p / 100 * float64(h.count)))
+	if target < 1 {
+		target = 1
+	}
+	var n int64
+	for _, b := range h.buckets() {
+		n += h.counts[b]
+		if n >= target {
+			v := histogramBucketEnd(b) - 1
+			if v > h.max {
+				v = h.max
+			}
+			return time.Duration(v) * time.Microsecond
+		}
+	}
+	return time.Duration(h.max) * time.Microsecond
+}
+
+func (h *histogram) mean() time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	return time.Duration(h.sum/h.count) * time.Microsecond
+}
+
+// histogramRange is a range of the histogram with the number of values in it.
+type histogramRange struct {
+	From  time.Duration
+	To    time.Duration
+	Count int64
+}
+
+// ranges merges the buckets into ranges from a power of two up to the next
+// one, the lowest range starts at 0.
+func (h *histogram) ranges() []*histogramRange {
+	var ranges []*histogramRange
+	for _, b := range h.buckets() {
+		from, to := int64(0), int64(1)
+		if b > 0 {
+			from = int64(1) << uint(bits.Len64(uint64(b))-1)
+			to = 2 * from
+		}
+		if len(ranges) == 0 || ranges[len(ranges)-1].From != time.Duration(from)*time.Microsecond {
+			ranges = append(ranges, &histogramRange{
+				From: time.Duration(from) * time.Microsecond,
+				To:   time.Duration(to) * time.Microsecond,
+			})
+		}
+		ranges[len(ranges)-1].Count += h.counts[b]
+	}
+	return ranges
+}
+
+// print prints the ranges of the histogram as bars.
+func (h *histogram) print(indent string) {
+	const width = 40
+	ranges := h.ranges()
+	var most int64
+	for _, r := range ranges {
+		if r.Count > most {
+			most = r.Count
+		}
+	}
+	for _, r := range ranges {
+		bar := int(math.Ceil(float64(r.Count) / float64(most) * width))
+		fmt.Printf("%s%10s - %-10s %-*s %d\n", indent, r.From, r.To, width, strings.Repeat("#", bar), r.Count)
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The types below mirror the JSON format of a test, they are used to write
+// tests files without empty properties.
+
+type testSuiteDef struct {
+	Default  *testDef `json:"default,omitempty"`
+	Includes []string `json:"includes"`
+}
+
+type testDef struct {
+	Label        string       `json:"label,omitempty"`
+	Request      *requestDef  `json:"request,omitempty"`
+	Response     *responseDef `json:"response,omitempty"`
+	UseCookieJar bool         `json:"useCookieJar,omitempty"`
+}
+
+type requestDef struct {
+	Method                string           `json:"method,omitempty"`
+	URL                   *urlDef          `json:"url,omitempty"`
+	URLUserInfo           *userInfoDef     `json:"urlUserInfo,omitempty"`
+	TLSInsecureSkipVerify bool             `json:"tlsInsecureSkipverify,omitempty"`
+	Headers               []*headerDef     `json:"headers,omitempty"`
+	BodyString            string           `json:"bodyString,omitempty"`
+	BodyJson              interface{}      `json:"bodyJson,omitempty"`
+	BodyMultipart         []*multipartPart `json:"bodyMultipart,omitempty"`
+	BodyForm              keyValues        `json:"bodyForm,omitempty"`
+}
+
+type urlDef struct {
+	Scheme   string `json:"scheme,omitempty"`
+	Host     string `json:"host,omitempty"`
+	Path     string `json:"path,omitempty"`
+	RawQuery string `json:"rawQuery,omitempty"`
+	Fragment string `json:"fragment,omitempty"`
+}
+
+type userInfoDef struct {
+	User     string `json:"user"`
+	Password string `json:"password"`
+}
+
+type headerDef struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type responseDef struct {
+	StatusCode     int                    `json:"statusCode,omitempty"`
+	BodyCheck      bool                   `json:"bodyCheck,omitempty"`
+	BodyString     string                 `json:"bodyString,omitempty"`
+	BodyJsonSchema map[string]interface{} `json:"bodyJsonSchema,omitempty"`
+}
+
+// newRequestDef creates a request from a method and an absolute url, user
+// info in the url is moved to the urlUserInfo property.
+func newRequestDef(method string, u *url.URL) *requestDef {
+	r := &requestDef{
+		Method: method,
+		URL: &urlDef{
+			Scheme:   u.Scheme,
+			Host:     u.Host,
+			Path:     u.Path,
+			RawQuery: u.RawQuery,
+			Fragment: u.Fragment,
+		},
+	}
+	if u.User != nil {
+		password, _ := u.User.Password()
+		r.URLUserInfo = &userInfoDef{User: u.User.Username(), Password: password}
+	}
+	return r
+}
+
+func (t *testDef) hasRequestHeader(key string) bool {
+	for _, h := range t.Request.Headers {
+		if strings.EqualFold(h.Key, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// requestHeader returns the value of the first request header with key.
+func (t *testDef) requestHeader(key string) string {
+	for _, h := range t.Request.Headers {
+		if strings.EqualFold(h.Key, key) {
+			return h.Value
+		}
+	}
+	return ""
+}
+
+// jsonBody returns the body as JSON value if the body is valid JSON.
+func jsonBody(body string) (interface{}, bool) {
+	var v interface{}
+	if err := json.Unmarshal([]byte(body), &v); err != nil || v == nil {
+		return nil, false
+	}
+	return v, true
+}
+
+// marshalJSON is like json.MarshalIndent but doesn't escape HTML characters,
+// '&' in urls and bodies stays readable.
+func marshalJSON(v interface{}, indent string) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", indent)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeJSONFile(fp string, v interface{}) error {
+	b, err := marshalJSON(v, "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(fp), 0755); err != nil {
+		return err
+	}
+	fmt.Printf("\033[1;37mwriting\033[0m %s\n", fp)
+	return ioutil.WriteFile(fp, b, 0644)
+}
+
+// fileName turns a name into a name which can be safely used as file or
+// directory name.
+func fileName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		}
+		return '_'
+	}, strings.TrimSpace(name))
+	name = strings.Trim(name, "._")
+	if name == "" {
+		name = "unnamed"
+	}
+	return name
+}
+
+// uniqueName returns name, or name suffixed with a number if name is already
+// used.
+func uniqueName(used map[string]bool, name, ext string) string {
+	n := name + ext
+	for i := 2; used[strings.ToLower(n)]; i++ {
+		n = fmt.Sprintf("%s_%d%s", name, i, ext)
+	}
+	used[strings.ToLower(n)] = true
+	return n
+}
+
+func warn(format string, a ...interface{}) {
+	fmt.Printf("\033[1;33mWARNING\033[0m "+format+"\n", a...)
+}
+
+// parseFlags parses flags which may be given before or after the positional
+// arguments and returns the positional arguments.
+func parseFlags(fs *flag.FlagSet, args []string) []string {
+	positional := make([]string, 0)
+	for {
+		fs.Parse(args)
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// importCommand converts requests from other tools into tests files.
+func importCommand(args []string) {
+	if len(args) == 0 {
+		importUsage()
+	}
+	fs := flag.NewFlagSet("import "+args[0], flag.ExitOnError)
+	output := fs.String("o", ".", "output directory")
+	var run func(fp string) error
+	switch args[0] {
+	case "postman":
+		run = func(fp string) error {
+			return ImportPostman(fp, *output)
+		}
+	case "har":
+		snapshot := fs.Bool("snapshot", false, "check the response body against the recorded response body")
+		run = func(fp string) error {
+			return ImportHAR(fp, *output, *snapshot)
+		}
+	case "curl":
+		importCurl(args[1:])
+		return
+	default:
+		importUsage()
+	}
+	positional := parseFlags(fs, args[1:])
+	if len(positional) != 1 {
+		importUsage()
+	}
+	if err := run(positional[0]); err != nil {
+		fmt.Printf("\033[1;31m%s\033[0m\n", err)
+		os.Exit(1)
+	}
+}
+
+// generateCommand generates tests files from API descriptions.
+func generateCommand(args []string) {
+	if len(args) == 0 || args[0] != "openapi" {
+		generateUsage()
+	}
+	fs := flag.NewFlagSet("generate openapi", flag.ExitOnError)
+	output := fs.String("o", ".", "output directory")
+	positional := parseFlags(fs, args[1:])
+	if len(positional) != 1 {
+		generateUsage()
+	}
+	if err := GenerateOpenAPI(positional[0], *output); err != nil {
+		fmt.Printf("\033[1;31m%s\033[0m\n", err)
+		os.Exit(1)
+	}
+}
+
+func generateUsage() {
+	fmt.Println("usage: httpapitester generate openapi [OpenAPI document] [-o output directory]")
+	os.Exit(2)
+}
+
+// importCurl parses the flags up to the curl command, the options of the curl
+// command must not be parsed as flags.
+func importCurl(args []string) {
+	fs := flag.NewFlagSet("import curl", flag.ExitOnError)
+	output := fs.String("o", "", "tests file to append the test to")
+	label := fs.String("label", "", "label of the test")
+	fs.Parse(args)
+	if *output == "" || fs.NArg() == 0 {
+		importUsage()
+	}
+	if err := ImportCurl(fs.Args(), *output, *label); err != nil {
+		fmt.Printf("\033[1;31m%s\033[0m\n", err)
+		os.Exit(1)
+	}
+}
+
+func importUsage() {
+	fmt.Print("usage: httpapitester import postman [collection file] [-o output directory]\n" +
+		"       httpapitester import har [har file] [-o output directory] [-snapshot]\n" +
+		"       httpapitester import curl -o [tests file] [-label label] [curl command]\n")
+	os.Exit(2)
+}
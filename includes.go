@@ -89,5 +89,8 @@ func ReadTestsFile(fp string) ([]*Test, error) {
 			return nil, fmt.Errorf("%s: %s", fp, err)
 		}
 	}
+	for _, t := range tests {
+		t.fp = fp
+	}
 	return tests, nil
 }
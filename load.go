@@ -0,0 +1,394 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// loadStats are the results of the requests of a label.
+type loadStats struct {
+	label    string
+	requests int64
+	failures int64
+	reasons  map[string]int64
+	latency  *histogram // of the requests which received a response
+}
+
+func newLoadStats(label string) *loadStats {
+	return &loadStats{label: label, reasons: make(map[string]int64), latency: newHistogram()}
+}
+
+// loadTest repeatedly runs copies of the selected tests with a number of
+// workers for a duration.
+type loadTest struct {
+	ts          *TestSuite
+	tests       []*Test
+	concurrency int
+	duration    time.Duration
+	rps         float64 // 0 is unlimited
+	mu          sync.Mutex
+	total       *loadStats
+	labels      map[string]*loadStats
+	elapsed     time.Duration
+}
+
+// maxLoadRPS is the highest requests per second limit, the requests are
+// started at an interval of at least a microsecond.
+const maxLoadRPS = 1e6
+
+// durationGiven matches the given duration of a failed duration or timing
+// assertion, it's left out of the failure reason.
+var durationGiven = regexp.MustCompile(`, given ([0-9.]+(h|m|s|ms|µs|ns))+$`)
+
+// exitOnSetupError stops the load test if the test can't be set up.
+func exitOnSetupError(t *Test) {
+	if t.setupErr != nil {
+		fmt.Printf("\033[1;31msuite setup failed: %s\033[0m\n", t.setupErr)
+		os.Exit(1)
+	}
+}
+
+// failureReason returns the first error of the failed test, without the
+// request url of transport errors and the given durations.
+func failureReason(t *Test) string {
+	if t.setupErr != nil {
+		return t.setupErr.Error()
+	}
+	if len(t.errs) == 0 {
+		return "failed"
+	}
+	err := t.errs[0]
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	return durationGiven.ReplaceAllString(err.Error(), "")
+}
+
+// loadCommand runs a load test with the tests of a test suite.
+func loadCommand(args []string) {
+	fs := flag.NewFlagSet("load", flag.ExitOnError)
+	concurrency := fs.Int("c", 10, "the number of tests which run concurrently")
+	d := fs.Duration("d", 10*time.Second, "the duration of the load test")
+	rps := fs.Float64("rps", 0, "the maximum number of requests per second, 0 is unlimited")
+	label := fs.String("label", "", "only run tests with a label matching this regular expression")
+	report := fs.String("report", "", "write the results as JSON to this file")
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		// the flags can follow the test suite file
+		file := fs.Arg(0)
+		fs.Parse(fs.Args()[1:])
+		args = append([]string{file}, fs.Args()...)
+	} else {
+		args = fs.Args()
+	}
+	if len(args) != 1 || *concurrency < 1 || *d <= 0 || !(*rps >= 0 && *rps <= maxLoadRPS) {
+		fmt.Println("usage: httpapitester load [test suite file] [-c concurrency] [-d duration] [-rps requests per second] [-label regexp] [-report file]")
+		os.Exit(2)
+	}
+	var re *regexp.Regexp
+	if *label != "" {
+		var err error
+		if re, err = regexp.Compile(*label); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	ts, err := ReadTestSuite(args[0])
+	if err != nil {
+		log.Fatal(err)
+	}
+	tests, err := GetTests(ts.fp, ts.Includes)
+	if err != nil {
+		log.Fatal(err)
+	}
+	lt := &loadTest{
+		ts:          ts,
+		concurrency: *concurrency,
+		duration:    *d,
+		rps:         *rps,
+		total:       newLoadStats(""),
+		labels:      make(map[string]*loadStats),
+	}
+	for _, t := range tests {
+		if re == nil || re.MatchString(t.Label) {
+			lt.tests = append(lt.tests, t)
+		}
+	}
+	if len(lt.tests) == 0 {
+		log.Fatal("no tests selected, the tests of includes are run by the load test")
+	}
+	maxIdleConnsPerHost = lt.concurrency
+
+	fmt.Println(version)
+	if ts.Default != nil {
+		ts.Default.offline = true
+		ts.Default.Prepare(nil)
+	}
+	for _, t := range ts.First {
+		t.Prepare(ts.Default)
+		exitOnSetupError(t)
+		if !t.Run() {
+			fmt.Println("\033[1;31mone of the first tests failed I will not start the load test\033[0m")
+			os.Exit(1)
+		}
+	}
+	// the tokens are requested before the load starts
+	for _, test := range lt.tests {
+		t := test.clone()
+		t.quiet = true
+		t.Prepare(ts.Default)
+		t.closeRequestBody()
+		exitOnSetupError(t)
+	}
+	lt.run()
+	for _, t := range ts.Last {
+		t.Prepare(ts.Default)
+		t.Run()
+	}
+	lt.print()
+	if *report != "" {
+		if err := lt.writeReport(*report); err != nil {
+			fmt.Printf("\033[1;31mreport: %s\033[0m\n", err)
+		}
+	}
+}
+
+func (lt *loadTest) run() {
+	start := time.Now()
+	deadline := start.Add(lt.duration)
+	var tokens <-chan time.Time
+	if lt.rps > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / lt.rps))
+		defer ticker.Stop()
+		tokens = ticker.C
+	}
+	var next int64
+	var wg sync.WaitGroup
+	for i := 0; i < lt.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				if tokens != nil {
+					select {
+					case <-tokens:
+					case <-time.After(time.Until(deadline)):
+						return
+					}
+				}
+				if !time.Now().Before(deadline) {
+					return
+				}
+				n := atomic.AddInt64(&next, 1) - 1
+				lt.runTest(lt.tests[n%int64(len(lt.tests))])
+			}
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	progress := time.NewTicker(time.Second)
+	defer progress.Stop()
+	for {
+		select {
+		case <-done:
+			lt.elapsed = time.Since(start)
+			lt.printProgress()
+			fmt.Println("")
+			return
+		case <-progress.C:
+			lt.elapsed = time.Since(start)
+			lt.printProgress()
+		}
+	}
+}
+
+// runTest runs a copy of the test and records the result.
+func (lt *loadTest) runTest(test *Test) {
+	t := test.clone()
+	t.quiet = true
+	t.Prepare(lt.ts.Default)
+	ok := t.Run()
+
+	label := t.Label
+	if label == "" {
+		label = t.fp
+	}
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	stats := lt.labels[label]
+	if stats == nil {
+		stats = newLoadStats(label)
+		lt.labels[label] = stats
+	}
+	for _, s := range []*loadStats{lt.total, stats} {
+		s.requests++
+		if t.response != nil {
+			s.latency.record(t.trace.duration("total"))
+		}
+		if !ok {
+			s.failures++
+			s.reasons[failureReason(t)]++
+		}
+	}
+}
+
+func (lt *loadTest) printProgress() {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	fmt.Printf("\r\033[1;37mLoad %s of %s\033[0m %d requests", lt.elapsed.Round(time.Second), lt.duration, lt.total.requests)
+	if lt.total.failures > 0 {
+		fmt.Printf(" \033[1;31m(%d FAILED)\033[0m", lt.total.failures)
+	}
+}
+
+func (lt *loadTest) throughput(s *loadStats) float64 {
+	return float64(s.requests) / lt.elapsed.Seconds()
+}
+
+func errorRate(s *loadStats) float64 {
+	if s.requests == 0 {
+		return 0
+	}
+	return float64(s.failures) / float64(s.requests) * 100
+}
+
+// sortedLabels returns the stats of the labels sorted by label.
+func (lt *loadTest) sortedLabels() []*loadStats {
+	labels := make([]*loadStats, 0, len(lt.labels))
+	for _, s := range lt.labels {
+		labels = append(labels, s)
+	}
+	sort.Slice(labels, func(i, j int) bool { return labels[i].label < labels[j].label })
+	return labels
+}
+
+// sortedReasons returns the failure reasons, the most frequent first.
+func sortedReasons(reasons map[string]int64) []string {
+	keys := make([]string, 0, len(reasons))
+	for k := range reasons {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if reasons[keys[i]] != reasons[keys[j]] {
+			return reasons[keys[i]] > reasons[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+func (lt *loadTest) print() {
+	color := "1;32"
+	if lt.total.failures > 0 {
+		color = "1;31"
+	}
+	fmt.Printf("\033[%sm%d requests in %s, %.1f requests/s, %d failed (%.2f%%)\033[0m\n",
+		color, lt.total.requests, lt.elapsed.Round(time.Millisecond), lt.throughput(lt.total), lt.total.failures, errorRate(lt.total))
+	for _, reason := range sortedReasons(lt.total.reasons) {
+		n := lt.total.reasons[reason]
+		fmt.Printf("  \033[0;31m%d (%.2f%%) %s\033[0m\n", n, float64(n)/float64(lt.total.requests)*100, reason)
+	}
+	for _, s := range lt.sortedLabels() {
+		h := s.latency
+		fmt.Printf("\n\033[1;37m%s\033[0m\n", s.label)
+		fmt.Printf("  \033[1;33mRequests\033[0m: %d, %.1f requests/s, %d failed (%.2f%%)\n", s.requests, lt.throughput(s), s.failures, errorRate(s))
+		for _, reason := range sortedReasons(s.reasons) {
+			fmt.Printf("    \033[0;31m%d %s\033[0m\n", s.reasons[reason], reason)
+		}
+		if h.count == 0 {
+			continue
+		}
+		fmt.Printf("  \033[1;33mLatency\033[0m: min %s, mean %s, p50 %s, p90 %s, p99 %s, max %s\n",
+			time.Duration(h.min)*time.Microsecond, h.mean(), h.percentile(50), h.percentile(90), h.percentile(99), time.Duration(h.max)*time.Microsecond)
+		h.print("  ")
+	}
+}
+
+// loadReport is the JSON report of a load test, durations are in
+// milliseconds.
+type loadReport struct {
+	Duration   float64            `json:"duration"`
+	Requests   int64              `json:"requests"`
+	Failures   int64              `json:"failures"`
+	Throughput float64            `json:"throughput"` // requests per second
+	Reasons    map[string]int64   `json:"reasons,omitempty"`
+	Labels     []*loadLabelReport `json:"labels"`
+}
+
+type loadLabelReport struct {
+	Label      string                `json:"label"`
+	Requests   int64                 `json:"requests"`
+	Failures   int64                 `json:"failures"`
+	Throughput float64               `json:"throughput"`
+	Reasons    map[string]int64      `json:"reasons,omitempty"`
+	Latency    map[string]float64    `json:"latency"`
+	Histogram  []*loadHistogramRange `json:"histogram"`
+}
+
+type loadHistogramRange struct {
+	From  float64 `json:"from"`
+	To    float64 `json:"to"`
+	Count int64   `json:"count"`
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func (lt *loadTest) writeReport(fp string) error {
+	r := &loadReport{
+		Duration:   milliseconds(lt.elapsed),
+		Requests:   lt.total.requests,
+		Failures:   lt.total.failures,
+		Throughput: lt.throughput(lt.total),
+		Reasons:    lt.total.reasons,
+		Labels:     make([]*loadLabelReport, 0, len(lt.labels)),
+	}
+	for _, s := range lt.sortedLabels() {
+		h := s.latency
+		l := &loadLabelReport{
+			Label:      s.label,
+			Requests:   s.requests,
+			Failures:   s.failures,
+			Throughput: lt.throughput(s),
+			Reasons:    s.reasons,
+			Latency: map[string]float64{
+				"min":  milliseconds(time.Duration(h.min) * time.Microsecond),
+				"mean": milliseconds(h.mean()),
+				"p50":  milliseconds(h.percentile(50)),
+				"p90":  milliseconds(h.percentile(90)),
+				"p99":  milliseconds(h.percentile(99)),
+				"max":  milliseconds(time.Duration(h.max) * time.Microsecond),
+			},
+			Histogram: make([]*loadHistogramRange, 0),
+		}
+		for _, hr := range h.ranges() {
+			l.Histogram = append(l.Histogram, &loadHistogramRange{milliseconds(hr.From), milliseconds(hr.To), hr.Count})
+		}
+		r.Labels = append(r.Labels, l)
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(r); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fp, buf.Bytes(), 0644)
+}
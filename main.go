@@ -1,31 +1,111 @@
 package main
 
 import (
-	"encoding/json"
+	"flag"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"os"
-	"path/filepath"
+	"regexp"
 )
 
+const version = "v2.1.2"
+
 func main() {
-	fmt.Println("v2.1.2")
-	if len(os.Args) != 2 || os.Args[1] == "" {
-		fmt.Println("HTTP API tester is a tool to test HTTP APIs\n\nusage: httpapitester [test suite file]\n")
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "export-curl":
+			exportCurl(os.Args[2:])
+			return
+		case "import":
+			importCommand(os.Args[2:])
+			return
+		case "generate":
+			generateCommand(os.Args[2:])
+			return
+		case "load":
+			loadCommand(os.Args[2:])
+			return
+		}
+	}
+
+	dryRun := flag.Bool("dry-run", false, "print the resolved requests in execution order without sending them")
+	jsonOutput := flag.Bool("json", false, "print the dry run plan as JSON")
+	report := flag.String("report", "", "write the test results with their timings as JSON to this file")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() != 1 || flag.Arg(0) == "" {
+		usage()
 		os.Exit(0)
 	}
-	testSuiteFP := os.Args[1]
 
-	b, err := ioutil.ReadFile(testSuiteFP)
+	testSuite, err := ReadTestSuite(flag.Arg(0))
 	if err != nil {
 		log.Fatal(err)
 	}
-	testSuite := &TestSuite{fp: filepath.Dir(testSuiteFP)}
-	if err := json.Unmarshal(b, testSuite); err != nil {
-		if _, ok := err.(*json.UnmarshalTypeError); !ok {
+	if *dryRun {
+		if err := testSuite.DryRun(*jsonOutput); err != nil {
 			log.Fatal(err)
 		}
+		return
 	}
+	fmt.Println(version)
+	testSuite.report = *report
 	testSuite.Run()
 }
+
+func usage() {
+	fmt.Println(version)
+	fmt.Print("HTTP API tester is a tool to test HTTP APIs\n\n" +
+		"usage: httpapitester [flags] [test suite file]\n" +
+		"       httpapitester export-curl [-label regexp] [test suite file]\n" +
+		"       httpapitester load [test suite file] [-c concurrency] [-d duration] [-rps requests per second] [-label regexp] [-report file]\n" +
+		"       httpapitester import postman [collection file] [-o output directory]\n" +
+		"       httpapitester import har [har file] [-o output directory] [-snapshot]\n" +
+		"       httpapitester import curl -o [tests file] [-label label] [curl command]\n" +
+		"       httpapitester generate openapi [OpenAPI document] [-o output directory]\n\n" +
+		"flags:\n")
+	flag.CommandLine.SetOutput(os.Stdout)
+	flag.PrintDefaults()
+	fmt.Println("")
+}
+
+// exportCurl prints a curl command for every selected test of a test suite
+// without running the tests.
+func exportCurl(args []string) {
+	fs := flag.NewFlagSet("export-curl", flag.ExitOnError)
+	label := fs.String("label", "", "only export tests with a label matching this regular expression")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fmt.Println("usage: httpapitester export-curl [-label regexp] [test suite file]")
+		os.Exit(2)
+	}
+	var re *regexp.Regexp
+	if *label != "" {
+		var err error
+		if re, err = regexp.Compile(*label); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	testSuite, err := ReadTestSuite(fs.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	tests, err := testSuite.prepareAll(true)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, t := range tests {
+		if re == nil || re.MatchString(t.Label) {
+			fmt.Printf("# %s (%s)\n", t.Label, t.fp)
+			if t.failed {
+				for _, err := range t.errs {
+					fmt.Printf("# %s\n", err)
+				}
+			} else {
+				fmt.Println(t.Curl())
+			}
+		}
+		t.closeRequestBody()
+	}
+}
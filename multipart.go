@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// A multipartPart is a text field if no filename or file is set, otherwise
+// it's a file part with inline content or the content of a file.
+type multipartPart struct {
+	Name        string `json:"name"`
+	Value       string `json:"value,omitempty"`
+	Filename    string `json:"filename,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+	Content     string `json:"content,omitempty"`
+	File        string `json:"file,omitempty"`
+}
+
+func (p *multipartPart) isFile() bool {
+	return p.Filename != "" || p.File != ""
+}
+
+// isMultipart reports whether the request body is multipart, the other body
+// properties preceed above bodyMultipart.
+func (t *Test) isMultipart() bool {
+	return t.Request.BodyString == "" && t.Request.BodyJson == nil && t.Request.BodyFile == "" && t.Request.BodyMultipart != nil
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// multipartBody writes the parts of the request as multipart/form-data body,
+// the content type with the boundary is set as request content type.
+func (t *Test) multipartBody() (io.Reader, error) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	for _, p := range t.Request.BodyMultipart {
+		if !p.isFile() {
+			if err := w.WriteField(p.Name, p.Value); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		filename := p.Filename
+		if filename == "" {
+			filename = filepath.Base(p.File)
+		}
+		contentType := p.ContentType
+		if contentType == "" {
+			if contentType = mime.TypeByExtension(filepath.Ext(filename)); contentType == "" {
+				contentType = "application/octet-stream"
+			}
+		}
+		h := make(textproto.MIMEHeader)
+		h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, quoteEscaper.Replace(p.Name), quoteEscaper.Replace(filename)))
+		h.Set("Content-Type", contentType)
+		pw, err := w.CreatePart(h)
+		if err != nil {
+			return nil, err
+		}
+		if p.File == "" {
+			if _, err := io.WriteString(pw, p.Content); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		f, err := os.Open(t.relativePath(p.File))
+		if err != nil {
+			return nil, err
+		}
+		_, err = io.Copy(pw, f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	t.requestContentType = w.FormDataContentType()
+	t.requestBodySize = int64(buf.Len())
+	return &buf, nil
+}
+
+// printMultipart prints the parts of the request body, the content of files
+// is not printed.
+func (t *Test) printMultipart() {
+	fmt.Printf("multipart/form-data (%d bytes)\n", t.requestBodySize)
+	for _, p := range t.Request.BodyMultipart {
+		switch {
+		case !p.isFile():
+			fmt.Printf("    %s: %s\n", p.Name, p.Value)
+		case p.File != "":
+			fmt.Printf("    %s: file %s\n", p.Name, t.relativePath(p.File))
+		default:
+			fmt.Printf("    %s: file %s (%d bytes)\n", p.Name, p.Filename, len(p.Content))
+		}
+	}
+}
+
+// curlMultipart returns the curl -F options for the parts of the request
+// body.
+func (t *Test) curlMultipart() string {
+	var buf bytes.Buffer
+	for _, p := range t.Request.BodyMultipart {
+		if !p.isFile() {
+			buf.WriteString(" --form-string ")
+			buf.WriteString(shellQuote(p.Name + "=" + p.Value))
+			continue
+		}
+		var value string
+		if p.File != "" {
+			value = `@"` + quoteEscaper.Replace(t.relativePath(p.File)) + `"`
+		} else {
+			// curl sends inline content as file if a filename is set
+			value = `"` + quoteEscaper.Replace(p.Content) + `"`
+		}
+		if p.Filename != "" {
+			value += `;filename="` + quoteEscaper.Replace(p.Filename) + `"`
+		}
+		if p.ContentType != "" {
+			value += ";type=" + p.ContentType
+		}
+		buf.WriteString(" -F ")
+		buf.WriteString(shellQuote(p.Name + "=" + value))
+	}
+	return buf.String()
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// oauth2Auth gets an access token from the token endpoint of an OAuth 2.0
+// authorization server with the client credentials or the password grant.
+type oauth2Auth struct {
+	TokenURL     string   `json:"tokenUrl"`
+	GrantType    string   `json:"grantType"` // client_credentials or password
+	ClientID     string   `json:"clientId"`
+	ClientSecret string   `json:"clientSecret"`
+	Scopes       []string `json:"scopes"`
+	User         string   `json:"user"`
+	Password     string   `json:"password"`
+	ClientAuth   string   `json:"clientAuth"` // header or body
+}
+
+type oauth2Token struct {
+	accessToken  string
+	refreshToken string
+	expiry       time.Time
+	err          error // the token request failed, it isn't requested again
+}
+
+// oauth2Tokens caches the tokens and the failed token requests for the run of
+// the test suite, the key is the expanded configuration.
+var oauth2Tokens = make(map[string]*oauth2Token)
+
+// oauth2TokensMu guards the tokens, concurrent tests wait for the token which
+// is requested instead of requesting one each.
+var oauth2TokensMu sync.Mutex
+
+// oauth2ExpiryDelta renews a token shortly before it expires, so it doesn't
+// expire while the request is sent.
+const oauth2ExpiryDelta = 10 * time.Second
+
+// expand returns a copy of the configuration with the values expanded as
+// template.
+func (a *oauth2Auth) expand() (*oauth2Auth, error) {
+	c := *a
+	c.Scopes = make([]string, len(a.Scopes))
+	var err error
+	for _, v := range []struct {
+		name string
+		s    *string
+	}{
+		{"tokenUrl", &c.TokenURL},
+		{"clientId", &c.ClientID},
+		{"clientSecret", &c.ClientSecret},
+		{"user", &c.User},
+		{"password", &c.Password},
+	} {
+		if *v.s, err = expandTemplate("auth.oauth2."+v.name, *v.s); err != nil {
+			return nil, err
+		}
+	}
+	for i, scope := range a.Scopes {
+		if c.Scopes[i], err = expandTemplate("auth.oauth2.scopes", scope); err != nil {
+			return nil, err
+		}
+	}
+	if c.TokenURL == "" {
+		return nil, errors.New("auth.oauth2.tokenUrl missing")
+	}
+	switch c.GrantType {
+	case "", "client_credentials":
+		c.GrantType = "client_credentials"
+	case "password":
+	default:
+		return nil, fmt.Errorf("auth.oauth2.grantType must be client_credentials or password, given %q", c.GrantType)
+	}
+	switch c.ClientAuth {
+	case "", "header", "body":
+	default:
+		return nil, fmt.Errorf("auth.oauth2.clientAuth must be header or body, given %q", c.ClientAuth)
+	}
+	return &c, nil
+}
+
+func (a *oauth2Auth) key() string {
+	b, _ := json.Marshal(a)
+	return string(b)
+}
+
+// token returns the cached access token, a new token is requested if there is
+// none, the token expired or renew is true. A refresh token is tried first. If
+// the token request failed its error is returned.
+func (a *oauth2Auth) token(client *http.Client, renew bool) (string, error) {
+	c, err := a.expand()
+	if err != nil {
+		return "", err
+	}
+	key := c.key()
+	oauth2TokensMu.Lock()
+	defer oauth2TokensMu.Unlock()
+	tok := oauth2Tokens[key]
+	if tok != nil && tok.err != nil {
+		return "", tok.err
+	}
+	if tok != nil && !renew && (tok.expiry.IsZero() || time.Now().Add(oauth2ExpiryDelta).Before(tok.expiry)) {
+		return tok.accessToken, nil
+	}
+	var newTok *oauth2Token
+	if tok != nil && tok.refreshToken != "" {
+		newTok, err = c.requestToken(url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {tok.refreshToken},
+		}, client)
+	}
+	if newTok == nil {
+		v := url.Values{"grant_type": {c.GrantType}}
+		if c.GrantType == "password" {
+			v.Set("username", c.User)
+			v.Set("password", c.Password)
+		}
+		if len(c.Scopes) > 0 {
+			v.Set("scope", strings.Join(c.Scopes, " "))
+		}
+		if newTok, err = c.requestToken(v, client); err != nil {
+			oauth2Tokens[key] = &oauth2Token{err: err}
+			return "", err
+		}
+	}
+	if newTok.refreshToken == "" && tok != nil {
+		newTok.refreshToken = tok.refreshToken
+	}
+	oauth2Tokens[key] = newTok
+	return newTok.accessToken, nil
+}
+
+// requestToken posts the parameters to the token endpoint, see RFC 6749
+// section 4.3, 4.4 and 6.
+func (a *oauth2Auth) requestToken(v url.Values, client *http.Client) (*oauth2Token, error) {
+	if a.ClientAuth == "body" {
+		v.Set("client_id", a.ClientID)
+		if a.ClientSecret != "" {
+			v.Set("client_secret", a.ClientSecret)
+		}
+	}
+	req, err := http.NewRequest("POST", a.TokenURL, strings.NewReader(v.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if a.ClientAuth != "body" && a.ClientID != "" {
+		req.SetBasicAuth(url.QueryEscape(a.ClientID), url.QueryEscape(a.ClientSecret))
+	}
+	resp, err := Call(req, client, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("oauth2 token request failed: %s", err)
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("oauth2 token request failed: %s", err)
+	}
+	r := &struct {
+		AccessToken      string      `json:"access_token"`
+		RefreshToken     string      `json:"refresh_token"`
+		ExpiresIn        json.Number `json:"expires_in"`
+		Error            string      `json:"error"`
+		ErrorDescription string      `json:"error_description"`
+	}{}
+	jsonErr := json.Unmarshal(b, r)
+	if resp.StatusCode != http.StatusOK {
+		if r.Error != "" {
+			return nil, fmt.Errorf("oauth2 token request to %s failed with status %d: %s", a.TokenURL, resp.StatusCode, strings.TrimSpace(r.Error+" "+r.ErrorDescription))
+		}
+		return nil, fmt.Errorf("oauth2 token request to %s failed with status %d", a.TokenURL, resp.StatusCode)
+	}
+	if jsonErr != nil {
+		return nil, fmt.Errorf("oauth2 token response of %s: %s", a.TokenURL, jsonErr)
+	}
+	if r.AccessToken == "" {
+		return nil, fmt.Errorf("oauth2 token response of %s: access_token missing", a.TokenURL)
+	}
+	tok := &oauth2Token{accessToken: r.AccessToken, refreshToken: r.RefreshToken}
+	if r.ExpiresIn != "" {
+		if s, err := strconv.ParseFloat(string(r.ExpiresIn), 64); err == nil && s > 0 {
+			tok.expiry = time.Now().Add(time.Duration(s * float64(time.Second)))
+		}
+	}
+	return tok, nil
+}
+
+// renewOAuth2 sends the request again with a new token if the response is
+// 401 Unauthorized and the request is authenticated with OAuth 2.0. The
+// request is only sent again if its body can be read again.
+func (t *Test) renewOAuth2(resp *http.Response) (*http.Response, error) {
+	auth := t.Request.Auth
+	if resp.StatusCode != http.StatusUnauthorized || auth == nil || auth.OAuth2 == nil ||
+		(t.request.Body != nil && t.request.GetBody == nil) {
+		return resp, nil
+	}
+	token, err := auth.OAuth2.token(t.client, true)
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	r := t.request.Clone(t.request.Context())
+	if t.request.GetBody != nil {
+		if r.Body, err = t.request.GetBody(); err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+	}
+	r.Header.Set("Authorization", "Bearer "+token)
+	ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	t.request = r
+	return Call(r, t.client, nil, t.trace)
+}
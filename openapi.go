@@ -0,0 +1,449 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+var openAPIMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// openAPI holds an OpenAPI 3 document as generic values, $ref's are resolved
+// against it.
+type openAPI struct {
+	doc map[string]interface{}
+}
+
+// GenerateOpenAPI writes a tests file per tag with a test for every operation
+// of an OpenAPI 3 document in YAML or JSON, and a test suite which has the
+// first server as default.
+func GenerateOpenAPI(fp, dir string) error {
+	b, err := ioutil.ReadFile(fp)
+	if err != nil {
+		return err
+	}
+	var v interface{}
+	if err := yaml.Unmarshal(b, &v); err != nil {
+		return fmt.Errorf("%s: %s", fp, err)
+	}
+	doc, ok := stringKeys(v).(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("%s: not an OpenAPI document", fp)
+	}
+	if _, ok := doc["swagger"]; ok {
+		return fmt.Errorf("%s: only OpenAPI 3 documents are supported", fp)
+	}
+	if _, ok := doc["openapi"]; !ok {
+		return fmt.Errorf("%s: not an OpenAPI document", fp)
+	}
+	o := &openAPI{doc: doc}
+
+	ts := &testSuiteDef{Includes: make([]string, 0)}
+	basePath := ""
+	if servers, ok := doc["servers"].([]interface{}); ok && len(servers) > 0 {
+		server := o.object(servers[0])
+		u, err := url.Parse(o.serverURL(server))
+		if err != nil {
+			return fmt.Errorf("server url: %s", err)
+		}
+		if u.Host != "" {
+			ts.Default = &testDef{Request: &requestDef{URL: &urlDef{Scheme: u.Scheme, Host: u.Host}}}
+		}
+		basePath = strings.TrimSuffix(u.Path, "/")
+	}
+
+	paths := o.object(doc["paths"])
+	keys := make([]string, 0, len(paths))
+	for k := range paths {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	tags := make([]string, 0)
+	files := make(map[string]string)
+	tests := make(map[string][]*testDef)
+	used := map[string]bool{strings.ToLower(includesFilename): true, "testsuite.json": true}
+	for _, path := range keys {
+		item := o.object(paths[path])
+		for _, method := range openAPIMethods {
+			op, ok := item[method]
+			if !ok {
+				continue
+			}
+			t, tag := o.test(strings.ToUpper(method), basePath, path, item, o.object(op))
+			if _, ok := files[tag]; !ok {
+				tags = append(tags, tag)
+				files[tag] = uniqueName(used, fileName(tag), ".json")
+				ts.Includes = append(ts.Includes, files[tag])
+			}
+			tests[tag] = append(tests[tag], t)
+		}
+	}
+	for _, tag := range tags {
+		if err := writeJSONFile(filepath.Join(dir, files[tag]), tests[tag]); err != nil {
+			return err
+		}
+	}
+	return writeJSONFile(filepath.Join(dir, "testsuite.json"), ts)
+}
+
+// test creates a test for an operation and returns the tag of the operation.
+func (o *openAPI) test(method, basePath, path string, item, op map[string]interface{}) (*testDef, string) {
+	label := method + " " + path
+	if id, ok := op["operationId"].(string); ok && id != "" {
+		label = id
+	}
+	t := &testDef{Label: label, Request: &requestDef{Method: method, URL: &urlDef{}}}
+
+	// parameters of the path item are overwritten by those of the operation
+	params := make(map[string]map[string]interface{})
+	names := make([]string, 0)
+	for _, list := range []interface{}{item["parameters"], op["parameters"]} {
+		l, _ := list.([]interface{})
+		for _, p := range l {
+			param := o.object(p)
+			key := fmt.Sprintf("%v:%v", param["in"], param["name"])
+			if _, ok := params[key]; !ok {
+				names = append(names, key)
+			}
+			params[key] = param
+		}
+	}
+	query := make([]string, 0)
+	for _, key := range names {
+		param := params[key]
+		name, _ := param["name"].(string)
+		value := o.parameterExample(param)
+		switch param["in"] {
+		case "path":
+			path = strings.Replace(path, "{"+name+"}", value, -1)
+		case "query":
+			if required, _ := param["required"].(bool); required {
+				query = append(query, url.QueryEscape(name)+"="+url.QueryEscape(value))
+			}
+		case "header":
+			if required, _ := param["required"].(bool); required {
+				t.Request.Headers = append(t.Request.Headers, &headerDef{Key: name, Value: value})
+			}
+		}
+	}
+	t.Request.URL.Path = basePath + path
+	t.Request.URL.RawQuery = strings.Join(query, "&")
+
+	if body := o.object(op["requestBody"]); body != nil {
+		o.requestBody(t, o.object(body["content"]))
+	}
+	o.response(t, o.object(op["responses"]))
+	return t, o.tag(op)
+}
+
+func (o *openAPI) requestBody(t *testDef, content map[string]interface{}) {
+	for _, mediaType := range sortedKeys(content) {
+		media := o.object(content[mediaType])
+		switch {
+		case strings.Contains(mediaType, "json"):
+			t.Request.BodyJson = o.mediaExample(media)
+		case mediaType == "application/x-www-form-urlencoded":
+			t.Request.BodyForm = make(keyValues, 0)
+			example, _ := o.mediaExample(media).(map[string]interface{})
+			for _, k := range sortedKeys(example) {
+				t.Request.BodyForm = append(t.Request.BodyForm, &keyValue{Key: k, Value: scalarString(example[k])})
+			}
+			return
+		case strings.HasPrefix(mediaType, "text/"):
+			t.Request.BodyString = scalarString(o.mediaExample(media))
+		default:
+			continue
+		}
+		t.Request.Headers = append(t.Request.Headers, &headerDef{Key: "Content-Type", Value: mediaType})
+		return
+	}
+	if len(content) > 0 {
+		warn("%s: request body of type %s not generated", t.Label, strings.Join(sortedKeys(content), ", "))
+	}
+}
+
+// response uses the lowest documented success status code and the JSON
+// schema of its response.
+func (o *openAPI) response(t *testDef, responses map[string]interface{}) {
+	code := 0
+	for k := range responses {
+		if c, err := strconv.Atoi(k); err == nil && c >= 200 && c < 300 && (code == 0 || c < code) {
+			code = c
+		}
+	}
+	if code == 0 {
+		return
+	}
+	t.Response = &responseDef{StatusCode: code}
+	resp := o.object(responses[strconv.Itoa(code)])
+	content := o.object(resp["content"])
+	for _, mediaType := range sortedKeys(content) {
+		if !strings.Contains(mediaType, "json") {
+			continue
+		}
+		if schema := o.object(o.object(content[mediaType])["schema"]); schema != nil {
+			s, err := o.jsonSchema(schema, make(map[string]bool))
+			if err != nil {
+				warn("%s: response schema not added, %s", t.Label, err)
+				return
+			}
+			t.Response.BodyCheck = true
+			t.Response.BodyJsonSchema = s.(map[string]interface{})
+		}
+		return
+	}
+}
+
+func (o *openAPI) tag(op map[string]interface{}) string {
+	if tags, ok := op["tags"].([]interface{}); ok && len(tags) > 0 {
+		if tag, ok := tags[0].(string); ok && tag != "" {
+			return tag
+		}
+	}
+	return "default"
+}
+
+// serverURL returns the url of a server with the default values of its
+// variables.
+func (o *openAPI) serverURL(server map[string]interface{}) string {
+	u, _ := server["url"].(string)
+	for name, v := range o.object(server["variables"]) {
+		u = strings.Replace(u, "{"+name+"}", scalarString(o.object(v)["default"]), -1)
+	}
+	return u
+}
+
+func (o *openAPI) parameterExample(param map[string]interface{}) string {
+	if v, ok := param["example"]; ok {
+		return scalarString(v)
+	}
+	if examples := o.object(param["examples"]); len(examples) > 0 {
+		return scalarString(o.object(examples[sortedKeys(examples)[0]])["value"])
+	}
+	return scalarString(o.example(o.object(param["schema"]), 0))
+}
+
+func (o *openAPI) mediaExample(media map[string]interface{}) interface{} {
+	if v, ok := media["example"]; ok {
+		return v
+	}
+	if examples := o.object(media["examples"]); len(examples) > 0 {
+		return o.object(examples[sortedKeys(examples)[0]])["value"]
+	}
+	return o.example(o.object(media["schema"]), 0)
+}
+
+// example generates an example value from a schema.
+func (o *openAPI) example(schema map[string]interface{}, depth int) interface{} {
+	if schema == nil || depth > 5 {
+		return nil
+	}
+	for _, k := range []string{"example", "default"} {
+		if v, ok := schema[k]; ok {
+			return v
+		}
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok && len(enum) > 0 {
+		return enum[0]
+	}
+	if all, ok := schema["allOf"].([]interface{}); ok {
+		merged := make(map[string]interface{})
+		for _, s := range all {
+			if m, ok := o.example(o.object(s), depth+1).(map[string]interface{}); ok {
+				for k, v := range m {
+					merged[k] = v
+				}
+			}
+		}
+		return merged
+	}
+	for _, k := range []string{"oneOf", "anyOf"} {
+		if list, ok := schema[k].([]interface{}); ok && len(list) > 0 {
+			return o.example(o.object(list[0]), depth+1)
+		}
+	}
+	typ, _ := schema["type"].(string)
+	if list, ok := schema["type"].([]interface{}); ok && len(list) > 0 {
+		typ, _ = list[0].(string)
+	}
+	switch {
+	case typ == "object" || (typ == "" && schema["properties"] != nil):
+		// only the required properties are used if the schema has any
+		required := make(map[string]bool)
+		if list, ok := schema["required"].([]interface{}); ok {
+			for _, name := range list {
+				required[scalarString(name)] = true
+			}
+		}
+		obj := make(map[string]interface{})
+		for name, s := range o.object(schema["properties"]) {
+			if len(required) > 0 && !required[name] {
+				continue
+			}
+			if v := o.example(o.object(s), depth+1); v != nil {
+				obj[name] = v
+			}
+		}
+		return obj
+	case typ == "array":
+		return []interface{}{o.example(o.object(schema["items"]), depth+1)}
+	case typ == "integer" || typ == "number":
+		if min, ok := schema["minimum"]; ok {
+			return min
+		}
+		return 1
+	case typ == "boolean":
+		return true
+	case typ == "string":
+		switch schema["format"] {
+		case "date":
+			return "2006-01-02"
+		case "date-time":
+			return "2006-01-02T15:04:05Z"
+		case "email":
+			return "user@example.com"
+		case "uuid":
+			return "00000000-0000-0000-0000-000000000000"
+		case "uri":
+			return "https://example.com"
+		}
+		return "string"
+	}
+	return nil
+}
+
+// jsonSchema converts an OpenAPI schema into a JSON schema: $ref's are
+// inlined, recursive references are replaced by an empty schema, and nullable
+// adds null to the type.
+func (o *openAPI) jsonSchema(v interface{}, refs map[string]bool) (interface{}, error) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if ref, ok := v["$ref"].(string); ok {
+			if refs[ref] {
+				return map[string]interface{}{}, nil
+			}
+			target, err := o.resolve(ref)
+			if err != nil {
+				return nil, err
+			}
+			refs[ref] = true
+			defer delete(refs, ref)
+			return o.jsonSchema(target, refs)
+		}
+		s := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			switch k {
+			case "example", "examples", "xml", "externalDocs", "discriminator", "readOnly", "writeOnly", "deprecated", "nullable":
+				continue
+			}
+			var err error
+			if s[k], err = o.jsonSchema(val, refs); err != nil {
+				return nil, err
+			}
+		}
+		if nullable, _ := v["nullable"].(bool); nullable {
+			if typ, ok := s["type"].(string); ok {
+				s["type"] = []interface{}{typ, "null"}
+			}
+		}
+		return s, nil
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for i, val := range v {
+			var err error
+			if l[i], err = o.jsonSchema(val, refs); err != nil {
+				return nil, err
+			}
+		}
+		return l, nil
+	}
+	return v, nil
+}
+
+// resolve returns the value a local $ref points to.
+func (o *openAPI) resolve(ref string) (interface{}, error) {
+	if !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("external reference %s not supported", ref)
+	}
+	var v interface{} = o.doc
+	for _, token := range strings.Split(ref[2:], "/") {
+		token = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, errors.New("invalid reference " + ref)
+		}
+		if v, ok = m[token]; !ok {
+			return nil, errors.New("invalid reference " + ref)
+		}
+	}
+	return v, nil
+}
+
+// object returns v as object, a $ref is resolved. Nil is returned if v is not
+// an object.
+func (o *openAPI) object(v interface{}) map[string]interface{} {
+	for i := 0; i < 10; i++ {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		ref, ok := m["$ref"].(string)
+		if !ok {
+			return m
+		}
+		var err error
+		if v, err = o.resolve(ref); err != nil {
+			warn("%s", err)
+			return nil
+		}
+	}
+	return nil
+}
+
+// stringKeys converts the map[interface{}]interface{} values of a YAML
+// document into JSON compatible map[string]interface{} values.
+func stringKeys(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			m[fmt.Sprint(k)] = stringKeys(val)
+		}
+		return m
+	case []interface{}:
+		for i, val := range v {
+			v[i] = stringKeys(val)
+		}
+	}
+	return v
+}
+
+func scalarString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case map[string]interface{}, []interface{}:
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+	return fmt.Sprint(v)
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// A Postman collection in the v2.0 or v2.1 format, only the properties which
+// can be converted to tests are read.
+type postmanCollection struct {
+	Info struct {
+		Name string `json:"name"`
+	} `json:"info"`
+	Item     []*postmanItem     `json:"item"`
+	Variable []*postmanKeyValue `json:"variable"`
+	Auth     *postmanAuth       `json:"auth"`
+	Event    []*postmanEvent    `json:"event"`
+}
+
+// A postmanItem is a folder if it has items, otherwise it's a request.
+type postmanItem struct {
+	Name    string          `json:"name"`
+	Item    []*postmanItem  `json:"item"`
+	Request json.RawMessage `json:"request"`
+	Auth    *postmanAuth    `json:"auth"`
+	Event   []*postmanEvent `json:"event"`
+}
+
+type postmanRequest struct {
+	Method string             `json:"method"`
+	URL    json.RawMessage    `json:"url"`
+	Header []*postmanKeyValue `json:"header"`
+	Body   *struct {
+		Mode       string             `json:"mode"`
+		Raw        string             `json:"raw"`
+		URLEncoded []*postmanKeyValue `json:"urlencoded"`
+		Options    struct {
+			Raw struct {
+				Language string `json:"language"`
+			} `json:"raw"`
+		} `json:"options"`
+	} `json:"body"`
+	Auth *postmanAuth `json:"auth"`
+}
+
+type postmanKeyValue struct {
+	Key      string      `json:"key"`
+	Value    interface{} `json:"value"`
+	Disabled bool        `json:"disabled"`
+}
+
+type postmanAuth struct {
+	Type   string             `json:"type"`
+	Basic  []*postmanKeyValue `json:"basic"`
+	Bearer []*postmanKeyValue `json:"bearer"`
+}
+
+type postmanEvent struct {
+	Listen string `json:"listen"`
+	Script struct {
+		Exec json.RawMessage `json:"exec"`
+	} `json:"script"`
+}
+
+var (
+	postmanVariableRegexp = regexp.MustCompile(`{{\s*([^{}]+?)\s*}}`)
+	postmanStatusRegexp   = regexp.MustCompile(`^pm\.response\.to\.have\.status\(\s*(\d{3})\s*\);?$`)
+)
+
+type postmanImport struct {
+	variables map[string]string
+}
+
+// ImportPostman converts a Postman collection into tests files in dir.
+// Folders become directories with an includes file, collection variables are
+// substituted and unsupported scripts are reported as warnings.
+func ImportPostman(fp, dir string) error {
+	b, err := ioutil.ReadFile(fp)
+	if err != nil {
+		return err
+	}
+	c := &postmanCollection{}
+	if err := json.Unmarshal(b, c); err != nil {
+		return fmt.Errorf("%s: %s", fp, err)
+	}
+	p := &postmanImport{variables: make(map[string]string)}
+	for _, v := range c.Variable {
+		if !v.Disabled {
+			p.variables[v.Key] = v.value()
+		}
+	}
+	p.warnScripts(c.Info.Name, c.Event)
+	return p.writeFolder(dir, c.Item, c.Auth)
+}
+
+// writeFolder writes the items of a folder to dir, consecutive requests are
+// written to the same tests file and every folder is written to a directory.
+// The includes file keeps the order of the items.
+func (p *postmanImport) writeFolder(dir string, items []*postmanItem, auth *postmanAuth) error {
+	used := map[string]bool{strings.ToLower(includesFilename): true}
+	includes := make([]string, 0)
+	var tests []*testDef
+	flush := func() error {
+		if len(tests) == 0 {
+			return nil
+		}
+		name := uniqueName(used, "tests", ".json")
+		includes = append(includes, name)
+		err := writeJSONFile(filepath.Join(dir, name), tests)
+		tests = nil
+		return err
+	}
+	for _, item := range items {
+		itemAuth := auth
+		if item.Auth != nil && item.Auth.Type != "inherit" {
+			itemAuth = item.Auth
+		}
+		if item.Item != nil || item.Request == nil {
+			if err := flush(); err != nil {
+				return err
+			}
+			p.warnScripts(item.Name, item.Event)
+			name := uniqueName(used, fileName(item.Name), "")
+			includes = append(includes, name)
+			if err := p.writeFolder(filepath.Join(dir, name), item.Item, itemAuth); err != nil {
+				return err
+			}
+			continue
+		}
+		t, err := p.test(item, itemAuth)
+		if err != nil {
+			return err
+		}
+		if t != nil {
+			tests = append(tests, t)
+		}
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	return writeJSONFile(filepath.Join(dir, includesFilename), includes)
+}
+
+func (p *postmanImport) test(item *postmanItem, auth *postmanAuth) (*testDef, error) {
+	r := &postmanRequest{}
+	if err := json.Unmarshal(item.Request, r); err != nil {
+		// the request can also be a url only
+		var raw string
+		if err := json.Unmarshal(item.Request, &raw); err != nil {
+			return nil, fmt.Errorf("%s: invalid request", item.Name)
+		}
+		r.URL, _ = json.Marshal(raw)
+	}
+	if r.Method == "" {
+		r.Method = "GET"
+	}
+	if r.Auth != nil && r.Auth.Type != "inherit" {
+		auth = r.Auth
+	}
+
+	rawURL := p.expand(item.Name, p.rawURL(r.URL))
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "http://" + rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		warn("%s: skipped, %s", item.Name, err)
+		return nil, nil
+	}
+	t := &testDef{Label: item.Name, Request: newRequestDef(strings.ToUpper(r.Method), u)}
+	for _, h := range r.Header {
+		if h.Disabled {
+			continue
+		}
+		t.Request.Headers = append(t.Request.Headers, &headerDef{
+			Key:   p.expand(item.Name, h.Key),
+			Value: p.expand(item.Name, h.value()),
+		})
+	}
+	p.body(t, item.Name, r)
+	p.auth(t, item.Name, auth)
+
+	// scripts
+	for _, e := range item.Event {
+		lines := e.lines()
+		if e.Listen != "test" {
+			if len(lines) > 0 {
+				warn("%s: %s script not translated", item.Name, e.Listen)
+			}
+			continue
+		}
+		for _, line := range lines {
+			if m := postmanStatusRegexp.FindStringSubmatch(line); m != nil {
+				if t.Response == nil {
+					t.Response = &responseDef{}
+				}
+				t.Response.StatusCode, _ = strconv.Atoi(m[1])
+			} else if !postmanIgnorableLine(line) {
+				warn("%s: test script not translated: %s", item.Name, line)
+			}
+		}
+	}
+	return t, nil
+}
+
+func (p *postmanImport) body(t *testDef, name string, r *postmanRequest) {
+	if r.Body == nil {
+		return
+	}
+	switch r.Body.Mode {
+	case "", "raw":
+		raw := p.expand(name, r.Body.Raw)
+		if v, ok := jsonBody(raw); ok && (r.Body.Options.Raw.Language == "json" || r.Body.Options.Raw.Language == "") {
+			t.Request.BodyJson = v
+		} else {
+			t.Request.BodyString = raw
+		}
+	case "urlencoded":
+		t.Request.BodyForm = make(keyValues, 0, len(r.Body.URLEncoded))
+		for _, kv := range r.Body.URLEncoded {
+			if !kv.Disabled {
+				t.Request.BodyForm = append(t.Request.BodyForm, &keyValue{Key: p.expand(name, kv.Key), Value: p.expand(name, kv.value())})
+			}
+		}
+	default:
+		warn("%s: %s body not translated", name, r.Body.Mode)
+	}
+}
+
+func (p *postmanImport) auth(t *testDef, name string, auth *postmanAuth) {
+	if auth == nil {
+		return
+	}
+	switch auth.Type {
+	case "noauth", "inherit":
+	case "basic":
+		t.Request.URLUserInfo = &userInfoDef{
+			User:     p.expand(name, postmanLookup(auth.Basic, "username")),
+			Password: p.expand(name, postmanLookup(auth.Basic, "password")),
+		}
+	case "bearer":
+		t.Request.Headers = append(t.Request.Headers, &headerDef{
+			Key:   "Authorization",
+			Value: "Bearer " + p.expand(name, postmanLookup(auth.Bearer, "token")),
+		})
+	default:
+		warn("%s: %s authentication not translated", name, auth.Type)
+	}
+}
+
+// rawURL returns the url of a request, which is a string or an object.
+func (p *postmanImport) rawURL(b json.RawMessage) string {
+	var raw string
+	if err := json.Unmarshal(b, &raw); err == nil {
+		return raw
+	}
+	u := &struct {
+		Raw      string             `json:"raw"`
+		Protocol string             `json:"protocol"`
+		Host     json.RawMessage    `json:"host"`
+		Port     string             `json:"port"`
+		Path     json.RawMessage    `json:"path"`
+		Query    []*postmanKeyValue `json:"query"`
+		Hash     string             `json:"hash"`
+	}{}
+	json.Unmarshal(b, u)
+	if u.Raw != "" {
+		return u.Raw
+	}
+	raw = postmanJoin(u.Host, ".")
+	if u.Protocol != "" {
+		raw = u.Protocol + "://" + raw
+	}
+	if u.Port != "" {
+		raw += ":" + u.Port
+	}
+	if path := postmanJoin(u.Path, "/"); path != "" {
+		raw += "/" + strings.TrimPrefix(path, "/")
+	}
+	query := make([]string, 0, len(u.Query))
+	for _, q := range u.Query {
+		if !q.Disabled {
+			query = append(query, q.Key+"="+q.value())
+		}
+	}
+	if len(query) > 0 {
+		raw += "?" + strings.Join(query, "&")
+	}
+	if u.Hash != "" {
+		raw += "#" + u.Hash
+	}
+	return raw
+}
+
+// expand substitutes the collection variables in s, variables which are not
+// defined are reported.
+func (p *postmanImport) expand(name, s string) string {
+	return postmanVariableRegexp.ReplaceAllStringFunc(s, func(m string) string {
+		key := postmanVariableRegexp.FindStringSubmatch(m)[1]
+		if v, ok := p.variables[key]; ok {
+			return v
+		}
+		warn("%s: variable %s is not defined in the collection", name, key)
+		return m
+	})
+}
+
+func (p *postmanImport) warnScripts(name string, events []*postmanEvent) {
+	for _, e := range events {
+		if len(e.lines()) > 0 {
+			warn("%s: %s script not translated", name, e.Listen)
+		}
+	}
+}
+
+// lines returns the non empty lines of the script, exec is a string or a list
+// of strings.
+func (e *postmanEvent) lines() []string {
+	var exec []string
+	if err := json.Unmarshal(e.Script.Exec, &exec); err != nil {
+		var s string
+		json.Unmarshal(e.Script.Exec, &s)
+		exec = []string{s}
+	}
+	lines := make([]string, 0)
+	for _, s := range exec {
+		for _, line := range strings.Split(s, "\n") {
+			if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "//") {
+				lines = append(lines, line)
+			}
+		}
+	}
+	return lines
+}
+
+// postmanIgnorableLine reports whether the line only belongs to the structure
+// of a test script, like pm.test("...", function () { and });
+func postmanIgnorableLine(line string) bool {
+	return (strings.HasPrefix(line, "pm.test(") && strings.HasSuffix(line, "{")) ||
+		line == "});" || line == "})" || line == "}"
+}
+
+func (kv *postmanKeyValue) value() string {
+	switch v := kv.Value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+}
+
+func postmanLookup(kvs []*postmanKeyValue, key string) string {
+	for _, kv := range kvs {
+		if kv.Key == key {
+			return kv.value()
+		}
+	}
+	return ""
+}
+
+// postmanJoin joins the parts of a host or path, which is a string or a list
+// of strings.
+func postmanJoin(b json.RawMessage, sep string) string {
+	var parts []string
+	if err := json.Unmarshal(b, &parts); err != nil {
+		var s string
+		json.Unmarshal(b, &s)
+		return s
+	}
+	return strings.Join(parts, sep)
+}
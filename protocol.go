@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// protocols maps the protocol option of a request to the protocols the
+// transport may use, auto is HTTP/2 over TLS if the server supports it and
+// HTTP/1.1 otherwise.
+var protocols = map[string]func(p *http.Protocols){
+	"http1.1": func(p *http.Protocols) { p.SetHTTP1(true) },
+	"h2":      func(p *http.Protocols) { p.SetHTTP2(true) },
+	"h2c":     func(p *http.Protocols) { p.SetUnencryptedHTTP2(true) },
+	"auto":    func(p *http.Protocols) { p.SetHTTP1(true); p.SetHTTP2(true) },
+}
+
+// transportProtocols returns the protocols of the transport, nil if the
+// transport defaults are used.
+func transportProtocols(protocol string) (*http.Protocols, error) {
+	if protocol == "" {
+		return nil, nil
+	}
+	set, ok := protocols[protocol]
+	if !ok {
+		return nil, fmt.Errorf("protocol must be http1.1, h2, h2c or auto, given %q", protocol)
+	}
+	p := new(http.Protocols)
+	set(p)
+	return p, nil
+}
+
+// curlProtocol returns the curl option of the protocol.
+func curlProtocol(protocol string) string {
+	switch protocol {
+	case "http1.1":
+		return " --http1.1"
+	case "h2":
+		return " --http2"
+	case "h2c":
+		return " --http2-prior-knowledge"
+	}
+	return ""
+}
+
+func (t *Test) evaluateProto() {
+	if t.Response.Proto != "" && t.Response.Proto != t.response.Proto {
+		t.fail(fmt.Errorf("expect protocol %s, given %s", t.Response.Proto, t.response.Proto))
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// proxyConfig describes the proxy of a request. Without url the proxy of the
+// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables is used, unless
+// disabled is true.
+type proxyConfig struct {
+	URL      string   `json:"url"`
+	NoProxy  []string `json:"noProxy"`
+	User     string   `json:"user"`
+	Password string   `json:"password"`
+	Disabled bool     `json:"disabled"`
+}
+
+// expand returns a copy of the configuration with the url and credentials
+// expanded as template.
+func (p *proxyConfig) expand() (*proxyConfig, error) {
+	c := *p
+	var err error
+	for _, v := range []struct {
+		name string
+		s    *string
+	}{
+		{"url", &c.URL},
+		{"user", &c.User},
+		{"password", &c.Password},
+	} {
+		if *v.s, err = expandTemplate("proxy."+v.name, *v.s); err != nil {
+			return nil, err
+		}
+	}
+	return &c, nil
+}
+
+// proxyURL returns the proxy url with the credentials.
+func (p *proxyConfig) proxyURL() (*url.URL, error) {
+	u, err := url.Parse(p.URL)
+	if err != nil {
+		return nil, fmt.Errorf("proxy.url: %s", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("proxy.url must be a http, https or socks5 url, given %q", p.URL)
+	}
+	if p.User != "" {
+		u.User = url.UserPassword(p.User, p.Password)
+	}
+	return u, nil
+}
+
+// proxyFunc returns the proxy function of the transport.
+func (p *proxyConfig) proxyFunc() (func(*http.Request) (*url.URL, error), error) {
+	if p == nil || (p.URL == "" && !p.Disabled) {
+		return http.ProxyFromEnvironment, nil
+	}
+	if p.Disabled {
+		return nil, nil
+	}
+	u, err := p.proxyURL()
+	if err != nil {
+		return nil, err
+	}
+	return func(r *http.Request) (*url.URL, error) {
+		if noProxy(r.URL, p.NoProxy) {
+			return nil, nil
+		}
+		return u, nil
+	}, nil
+}
+
+// noProxy reports whether the url matches one of the entries, like the
+// NO_PROXY environment variable: "*" matches all hosts, a domain matches the
+// domain and its subdomains, an IP address or CIDR range matches the IP
+// addresses and an entry with port only matches that port.
+func noProxy(u *url.URL, entries []string) bool {
+	host, port := u.Hostname(), u.Port()
+	if port == "" {
+		port = map[string]string{"http": "80", "https": "443"}[u.Scheme]
+	}
+	ip := net.ParseIP(host)
+	for _, entry := range entries {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "*" {
+			return true
+		}
+		if _, ipNet, err := net.ParseCIDR(entry); err == nil {
+			if ip != nil && ipNet.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		if h, p, err := net.SplitHostPort(entry); err == nil {
+			if p != port {
+				continue
+			}
+			entry = h
+		}
+		if entryIP := net.ParseIP(entry); entryIP != nil {
+			if ip != nil && entryIP.Equal(ip) {
+				return true
+			}
+			continue
+		}
+		entry = strings.TrimPrefix(strings.TrimPrefix(entry, "*"), ".")
+		if h := strings.ToLower(host); h == entry || strings.HasSuffix(h, "."+entry) {
+			return true
+		}
+	}
+	return false
+}
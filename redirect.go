@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// defaultMaxRedirects is the number of redirects which are followed if
+// followRedirects isn't set, like the http.Client.
+const defaultMaxRedirects = 10
+
+// maxRedirects is the maximum number of redirects which are followed. In JSON
+// it's true (follow up to 10 redirects), false or a number.
+type maxRedirects int
+
+func (m *maxRedirects) UnmarshalJSON(b []byte) error {
+	switch s := string(bytes.TrimSpace(b)); s {
+	case "true":
+		*m = defaultMaxRedirects
+	case "false":
+		*m = 0
+	default:
+		var n int
+		if err := json.Unmarshal(b, &n); err != nil || n < 0 {
+			return fmt.Errorf("followRedirects must be true, false or a number of redirects, given %s", s)
+		}
+		*m = maxRedirects(n)
+	}
+	return nil
+}
+
+// redirectHop is a redirect response which is followed.
+type redirectHop struct {
+	URL        string `json:"url,omitempty"`
+	StatusCode int    `json:"statusCode"`
+	Location   string `json:"location"`
+}
+
+func (t *Test) maxRedirects() int {
+	if t.Request.FollowRedirects == nil {
+		return defaultMaxRedirects
+	}
+	return int(*t.Request.FollowRedirects)
+}
+
+// checkRedirect is the redirect policy of the test, it records the redirects
+// which are followed. The cookies of the redirect responses are put in the
+// cookie jar and the jar cookies are sent with the next request.
+func (t *Test) checkRedirect(req *http.Request, via []*http.Request) error {
+	max := t.maxRedirects()
+	if max == 0 {
+		return http.ErrUseLastResponse
+	}
+	if len(via) > max {
+		return fmt.Errorf("stopped after %d redirects", max)
+	}
+	prev := via[len(via)-1]
+	t.redirects = append(t.redirects, &redirectHop{
+		URL:        prev.URL.String(),
+		StatusCode: req.Response.StatusCode,
+		Location:   req.Response.Header.Get("Location"),
+	})
+	if t.UseCookieJar && !t.NoCookieJar && t.cookieJar != nil {
+		t.cookieJar.SetCookies(prev.URL, req.Response.Cookies())
+		req.Header.Del("Cookie")
+		for _, c := range t.cookieJar.Cookies(req.URL) {
+			req.AddCookie(c)
+		}
+	}
+	return nil
+}
+
+func (t *Test) evaluateRedirects() {
+	if t.Response.Redirects != nil {
+		if len(t.Response.Redirects) != len(t.redirects) {
+			t.fail(fmt.Errorf("expect %d redirects, given %d", len(t.Response.Redirects), len(t.redirects)))
+		}
+		for i, hop := range t.Response.Redirects {
+			if i >= len(t.redirects) {
+				break
+			}
+			given := t.redirects[i]
+			if hop.StatusCode != 0 && hop.StatusCode != given.StatusCode {
+				t.fail(fmt.Errorf("expect redirect %d status code to equal %d, given %d", i+1, hop.StatusCode, given.StatusCode))
+			}
+			if hop.Location != "" && hop.Location != given.Location {
+				t.fail(fmt.Errorf("expect redirect %d location to equal %q, given %q", i+1, hop.Location, given.Location))
+			}
+		}
+	}
+	if t.Response.FinalURL != "" {
+		u := t.response.Request.URL
+		given := u.String()
+		if strings.HasPrefix(t.Response.FinalURL, "/") {
+			// a path is compared with the path and query
+			given = u.RequestURI()
+		}
+		if given != t.Response.FinalURL {
+			t.fail(fmt.Errorf("expect final url to equal %q, given %q", t.Response.FinalURL, given))
+		}
+	}
+}
+
+// printRedirects prints the followed redirects.
+func (t *Test) printRedirects() {
+	for _, hop := range t.redirects {
+		fmt.Printf("  \033[1;33mRedirect\033[0m: %d %s -> %s\n", hop.StatusCode, hop.URL, hop.Location)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+)
+
+// testResult is the result of a test in the report.
+type testResult struct {
+	Label      string        `json:"label"`
+	File       string        `json:"file"`
+	Passed     bool          `json:"passed"`
+	Errors     []string      `json:"errors,omitempty"`
+	StatusCode int           `json:"statusCode,omitempty"`
+	Timings    *requestTrace `json:"timings,omitempty"` // milliseconds
+	Curl       string        `json:"curl,omitempty"`    // of a failed test, masked
+}
+
+func newTestResult(t *Test) *testResult {
+	r := &testResult{Label: t.Label, File: t.fp, Passed: !t.failed, Timings: t.trace}
+	for _, err := range t.errs {
+		r.Errors = append(r.Errors, err.Error())
+	}
+	if t.response != nil {
+		r.StatusCode = t.response.StatusCode
+	}
+	if t.failed {
+		r.Curl = t.curl(true)
+	}
+	return r
+}
+
+// writeReport writes the results of the executed tests as JSON to the report
+// file, if one is set.
+func (ts *TestSuite) writeReport() error {
+	if ts.report == "" {
+		return nil
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(ts.results); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(ts.report, buf.Bytes(), 0644)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// resolveOverrides maps host:port to the ip:port connections are made to, like
+// curl's --resolve. It's set by the resolve property of the test suite.
+var resolveOverrides map[string]string
+
+// parseResolve checks the host:port keys and ip:port values of a resolve map,
+// it returns the map with lower case hosts.
+func parseResolve(resolve map[string]string) (map[string]string, error) {
+	m := make(map[string]string, len(resolve))
+	for from, to := range resolve {
+		if _, port, err := net.SplitHostPort(from); err != nil || port == "" {
+			return nil, fmt.Errorf("resolve: %q must be host:port", from)
+		}
+		host, port, err := net.SplitHostPort(to)
+		if err != nil || port == "" || net.ParseIP(host) == nil {
+			return nil, fmt.Errorf("resolve: %q of %q must be ip:port", to, from)
+		}
+		m[strings.ToLower(from)] = to
+	}
+	return m, nil
+}
+
+// resolveDialer connects to the overridden address of a host:port, other
+// addresses are dialed as given. The TLS server name is still taken from the
+// url, so the certificate is verified for the original host.
+func resolveDialer(resolve map[string]string) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	// the settings of the dialer of http.DefaultTransport
+	d := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if to, ok := resolve[strings.ToLower(addr)]; ok {
+			addr = to
+		}
+		return d.DialContext(ctx, network, addr)
+	}
+}
+
+// curlResolve returns the --resolve options of the resolve map.
+func curlResolve(resolve map[string]string) string {
+	keys := make([]string, 0, len(resolve))
+	for k := range resolve {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		host, port, _ := net.SplitHostPort(k)
+		ip, toPort, _ := net.SplitHostPort(resolve[k])
+		if toPort != port {
+			// curl can't change the port with --resolve
+			b.WriteString(" --connect-to " + shellQuote(k+":"+net.JoinHostPort(ip, toPort)))
+			continue
+		}
+		if strings.Contains(ip, ":") {
+			ip = "[" + ip + "]"
+		}
+		b.WriteString(" --resolve " + shellQuote(host+":"+port+":"+ip))
+	}
+	return b.String()
+}
+
+// requestHeader returns a copy of the request headers with the Host header if
+// it's set, net/http keeps it in the Host field of the request.
+func (t *Test) requestHeader() http.Header {
+	h := make(http.Header, len(t.request.Header)+1)
+	for k, v := range t.request.Header {
+		h[k] = v
+	}
+	if t.request.Host != "" && t.request.Host != t.request.URL.Host {
+		h.Set("Host", t.request.Host)
+	}
+	return h
+}
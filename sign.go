@@ -0,0 +1,391 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A signer signs a prepared request, bodyHash is the hex encoded SHA-256 hash
+// of the request body.
+type signer interface {
+	sign(r *http.Request, bodyHash string) error
+}
+
+// signConfig selects the signer of a request, only one signer should be set.
+// An empty sign object disables the signing of the default test.
+type signConfig struct {
+	HMAC     *hmacSigner     `json:"hmac"`
+	AWSSigV4 *awsSigV4Signer `json:"awsSigV4"`
+}
+
+func (c *signConfig) signer() signer {
+	switch {
+	case c.HMAC != nil:
+		return c.HMAC
+	case c.AWSSigV4 != nil:
+		return c.AWSSigV4
+	}
+	return nil
+}
+
+// prepareSign signs the request, it must be called when the url, headers,
+// cookies and body of the request are final.
+func (t *Test) prepareSign() {
+	if t.failed || t.Request.Sign == nil {
+		return
+	}
+	s := t.Request.Sign.signer()
+	if s == nil {
+		return
+	}
+	bodyHash, err := t.bodySHA256()
+	if err == nil {
+		err = s.sign(t.request, bodyHash)
+	}
+	if err != nil {
+		t.fail(err)
+	}
+}
+
+// bodySHA256 returns the hex encoded SHA-256 hash of the request body without
+// consuming the body.
+func (t *Test) bodySHA256() (string, error) {
+	h := sha256.New()
+	switch {
+	case t.request.Body == nil || t.request.Body == http.NoBody:
+	case t.request.GetBody != nil:
+		body, err := t.request.GetBody()
+		if err != nil {
+			return "", err
+		}
+		_, err = io.Copy(h, body)
+		body.Close()
+		if err != nil {
+			return "", err
+		}
+	default:
+		return "", errors.New("the request body cannot be read to be signed")
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hmacSigner signs the canonical string of a request with HMAC-SHA256. The
+// canonical string consists of the given components joined by the separator.
+type hmacSigner struct {
+	Key               string   `json:"key"`
+	KeyEncoding       string   `json:"keyEncoding"` // raw, hex or base64
+	KeyID             string   `json:"keyId"`
+	Canonical         []string `json:"canonical"`
+	Separator         *string  `json:"separator"`
+	DateHeader        string   `json:"dateHeader"`
+	DateFormat        string   `json:"dateFormat"` // http, rfc3339 or unix
+	BodyHashHeader    string   `json:"bodyHashHeader"`
+	Header            string   `json:"header"`
+	Format            string   `json:"format"`
+	SignatureEncoding string   `json:"signatureEncoding"` // hex or base64
+}
+
+var hmacDefaultCanonical = []string{"method", "path", "date", "bodyHash"}
+
+func (s *hmacSigner) sign(r *http.Request, bodyHash string) error {
+	key, err := expandTemplate("sign.hmac.key", s.Key)
+	if err != nil {
+		return err
+	}
+	keyID, err := expandTemplate("sign.hmac.keyId", s.KeyID)
+	if err != nil {
+		return err
+	}
+	var k []byte
+	switch s.KeyEncoding {
+	case "", "raw":
+		k = []byte(key)
+	case "hex":
+		k, err = hex.DecodeString(key)
+	case "base64":
+		k, err = base64.StdEncoding.DecodeString(key)
+	default:
+		return fmt.Errorf("sign.hmac.keyEncoding must be raw, hex or base64, given %q", s.KeyEncoding)
+	}
+	if err != nil {
+		return fmt.Errorf("sign.hmac.key: %s", err)
+	}
+
+	dateHeader := s.DateHeader
+	if dateHeader == "" {
+		dateHeader = "Date"
+	}
+	if r.Header.Get(dateHeader) == "" {
+		now := time.Now().UTC()
+		switch s.DateFormat {
+		case "", "http":
+			r.Header.Set(dateHeader, now.Format(http.TimeFormat))
+		case "rfc3339":
+			r.Header.Set(dateHeader, now.Format(time.RFC3339))
+		case "unix":
+			r.Header.Set(dateHeader, strconv.FormatInt(now.Unix(), 10))
+		default:
+			return fmt.Errorf("sign.hmac.dateFormat must be http, rfc3339 or unix, given %q", s.DateFormat)
+		}
+	}
+	if s.BodyHashHeader != "" {
+		r.Header.Set(s.BodyHashHeader, bodyHash)
+	}
+
+	canonical := s.Canonical
+	if len(canonical) == 0 {
+		canonical = hmacDefaultCanonical
+	}
+	parts := make([]string, 0, len(canonical))
+	for _, c := range canonical {
+		switch {
+		case c == "method":
+			parts = append(parts, r.Method)
+		case c == "host":
+			host := r.Host
+			if host == "" {
+				host = r.URL.Host
+			}
+			parts = append(parts, host)
+		case c == "path":
+			parts = append(parts, r.URL.EscapedPath())
+		case c == "query":
+			parts = append(parts, sortedQuery(r.URL.RawQuery))
+		case c == "date":
+			parts = append(parts, r.Header.Get(dateHeader))
+		case c == "bodyHash":
+			parts = append(parts, bodyHash)
+		case strings.HasPrefix(c, "header:"):
+			parts = append(parts, strings.Join(r.Header.Values(strings.TrimPrefix(c, "header:")), ","))
+		default:
+			return fmt.Errorf("sign.hmac.canonical: unknown component %q", c)
+		}
+	}
+	separator := "\n"
+	if s.Separator != nil {
+		separator = *s.Separator
+	}
+	mac := hmac.New(sha256.New, k)
+	io.WriteString(mac, strings.Join(parts, separator))
+
+	var signature string
+	switch s.SignatureEncoding {
+	case "", "hex":
+		signature = hex.EncodeToString(mac.Sum(nil))
+	case "base64":
+		signature = base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	default:
+		return fmt.Errorf("sign.hmac.signatureEncoding must be hex or base64, given %q", s.SignatureEncoding)
+	}
+	header := s.Header
+	if header == "" {
+		header = "Authorization"
+	}
+	format := s.Format
+	if format == "" {
+		format = "HMAC-SHA256 KeyId={keyId}, Signature={signature}"
+	}
+	r.Header.Set(header, strings.NewReplacer("{keyId}", keyID, "{signature}", signature).Replace(format))
+	return nil
+}
+
+// sortedQuery returns the query parameters sorted by key and value.
+func sortedQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	params := strings.Split(rawQuery, "&")
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+// awsSigV4Signer signs a request with the AWS Signature Version 4, see
+// https://docs.aws.amazon.com/IAM/latest/UserGuide/create-signed-request.html
+type awsSigV4Signer struct {
+	AccessKeyID     string `json:"accessKeyId"`
+	SecretAccessKey string `json:"secretAccessKey"`
+	SessionToken    string `json:"sessionToken"`
+	Region          string `json:"region"`
+	Service         string `json:"service"`
+	UnsignedPayload bool   `json:"unsignedPayload"`
+}
+
+const (
+	awsSigV4Algorithm  = "AWS4-HMAC-SHA256"
+	awsSigV4TimeFormat = "20060102T150405Z"
+)
+
+// awsSigV4IgnoredHeaders are not signed, they may be changed on the way to
+// the service.
+var awsSigV4IgnoredHeaders = map[string]bool{
+	"authorization":   true,
+	"user-agent":      true,
+	"x-amzn-trace-id": true,
+}
+
+func (s *awsSigV4Signer) sign(r *http.Request, bodyHash string) error {
+	var accessKeyID, secretAccessKey, sessionToken string
+	var err error
+	if accessKeyID, err = expandTemplate("sign.awsSigV4.accessKeyId", s.AccessKeyID); err != nil {
+		return err
+	}
+	if secretAccessKey, err = expandTemplate("sign.awsSigV4.secretAccessKey", s.SecretAccessKey); err != nil {
+		return err
+	}
+	if sessionToken, err = expandTemplate("sign.awsSigV4.sessionToken", s.SessionToken); err != nil {
+		return err
+	}
+	if accessKeyID == "" || secretAccessKey == "" || s.Region == "" || s.Service == "" {
+		return errors.New("sign.awsSigV4 needs accessKeyId, secretAccessKey, region and service")
+	}
+
+	// a given X-Amz-Date is kept, that is how the AWS test vectors are signed
+	now := time.Now().UTC()
+	if v := r.Header.Get("X-Amz-Date"); v != "" {
+		if now, err = time.Parse(awsSigV4TimeFormat, v); err != nil {
+			return fmt.Errorf("X-Amz-Date: %s", err)
+		}
+	} else {
+		r.Header.Set("X-Amz-Date", now.Format(awsSigV4TimeFormat))
+	}
+	if sessionToken != "" {
+		r.Header.Set("X-Amz-Security-Token", sessionToken)
+	}
+	if s.UnsignedPayload {
+		bodyHash = "UNSIGNED-PAYLOAD"
+	}
+	if s.Service == "s3" {
+		r.Header.Set("X-Amz-Content-Sha256", bodyHash)
+	}
+
+	canonicalHeaders, signedHeaders := awsCanonicalHeaders(r)
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		awsCanonicalPath(r.URL, s.Service),
+		awsCanonicalQuery(r.URL.RawQuery),
+		canonicalHeaders,
+		signedHeaders,
+		bodyHash,
+	}, "\n")
+	scope := strings.Join([]string{now.Format("20060102"), s.Region, s.Service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{
+		awsSigV4Algorithm,
+		now.Format(awsSigV4TimeFormat),
+		scope,
+		sha256Hex(canonicalRequest),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secretAccessKey), now.Format("20060102"))
+	for _, v := range []string{s.Region, s.Service, "aws4_request"} {
+		key = hmacSHA256(key, v)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	r.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		awsSigV4Algorithm, accessKeyID, scope, signedHeaders, signature))
+	return nil
+}
+
+// awsCanonicalHeaders returns the canonical headers, with the host, and the
+// list of signed headers.
+func awsCanonicalHeaders(r *http.Request) (string, string) {
+	host := r.Host
+	if host == "" {
+		host = r.URL.Host
+	}
+	values := map[string][]string{"host": {host}}
+	for k, v := range r.Header {
+		k = strings.ToLower(k)
+		if !awsSigV4IgnoredHeaders[k] && k != "host" {
+			values[k] = append(values[k], v...)
+		}
+	}
+	names := make([]string, 0, len(values))
+	for k := range values {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, k := range names {
+		v := make([]string, len(values[k]))
+		for i, s := range values[k] {
+			v[i] = strings.Join(strings.Fields(s), " ")
+		}
+		b.WriteString(k + ":" + strings.Join(v, ",") + "\n")
+	}
+	return b.String(), strings.Join(names, ";")
+}
+
+// awsCanonicalPath returns the canonical path, the escaped path is encoded a
+// second time for all services but S3, like the AWS SDKs do.
+func awsCanonicalPath(u *url.URL, service string) string {
+	p := u.EscapedPath()
+	if p == "" {
+		return "/"
+	}
+	if service == "s3" {
+		return p
+	}
+	return awsURIEncode(p, false)
+}
+
+// awsCanonicalQuery returns the URI encoded query parameters sorted by key and
+// value.
+func awsCanonicalQuery(rawQuery string) string {
+	params := make([]string, 0)
+	for _, pair := range strings.Split(rawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		key, value := pair, ""
+		if i := strings.Index(pair, "="); i >= 0 {
+			key, value = pair[:i], pair[i+1:]
+		}
+		if k, err := url.QueryUnescape(key); err == nil {
+			key = k
+		}
+		if v, err := url.QueryUnescape(value); err == nil {
+			value = v
+		}
+		params = append(params, awsURIEncode(key, true)+"="+awsURIEncode(value, true))
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+// awsURIEncode encodes every byte but the unreserved characters of RFC 3986,
+// and the slash if encodeSlash is false.
+func awsURIEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	io.WriteString(mac, data)
+	return mac.Sum(nil)
+}
+
+func sha256Hex(s string) string {
+	h := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(h[:])
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// The requests and signatures of the AWS Signature Version 4 test suite.
+func TestAWSSigV4(t *testing.T) {
+	s := &awsSigV4Signer{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		Region:          "us-east-1",
+		Service:         "service",
+	}
+	for _, tc := range []struct {
+		name, method, url, contentType, body, authorization string
+	}{
+		{
+			name:          "get-vanilla",
+			method:        "GET",
+			url:           "https://example.amazonaws.com/",
+			authorization: "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		{
+			name:          "get-vanilla-query-order",
+			method:        "GET",
+			url:           "https://example.amazonaws.com/?Param2=value2&Param1=value1",
+			authorization: "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500",
+		},
+		{
+			name:          "post-x-www-form-urlencoded",
+			method:        "POST",
+			url:           "https://example.amazonaws.com/",
+			contentType:   "application/x-www-form-urlencoded",
+			body:          "Param1=value1",
+			authorization: "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=content-type;host;x-amz-date, Signature=ff11897932ad3f4e8b18135d722051e5ac45fc38421b1da7b9d196a0fe09473a",
+		},
+	} {
+		r, err := http.NewRequest(tc.method, tc.url, strings.NewReader(tc.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Header.Set("X-Amz-Date", "20150830T123600Z")
+		if tc.contentType != "" {
+			r.Header.Set("Content-Type", tc.contentType)
+		}
+		if err := s.sign(r, sha256Hex(tc.body)); err != nil {
+			t.Fatalf("%s: %s", tc.name, err)
+		}
+		if given := r.Header.Get("Authorization"); given != tc.authorization {
+			t.Errorf("%s: expect Authorization %q, given %q", tc.name, tc.authorization, given)
+		}
+	}
+}
+
+func TestHMACCanonical(t *testing.T) {
+	s := &hmacSigner{
+		Key:       "secret",
+		KeyID:     "k1",
+		Canonical: []string{"method", "host", "path", "query", "date", "bodyHash", "header:X-Request-Id"},
+	}
+	body := `{"name":"x"}`
+	r, err := http.NewRequest("POST", "https://api.example.com/v1/items%20x?b=2&a=1", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Date", "Mon, 19 Oct 2026 12:00:00 GMT")
+	r.Header.Add("X-Request-Id", "r-1")
+	r.Header.Add("X-Request-Id", "r-2")
+	if err := s.sign(r, sha256Hex(body)); err != nil {
+		t.Fatal(err)
+	}
+	// HMAC-SHA256 of "POST\napi.example.com\n/v1/items%20x\na=1&b=2\n
+	// Mon, 19 Oct 2026 12:00:00 GMT\n<body hash>\nr-1,r-2"
+	expect := "HMAC-SHA256 KeyId=k1, Signature=457f6e1b3f6a35b9a0986bfd00c481977d08ce89d4e55e38b36307d35123e8a1"
+	if given := r.Header.Get("Authorization"); given != expect {
+		t.Errorf("expect Authorization %q, given %q", expect, given)
+	}
+}
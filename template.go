@@ -0,0 +1,28 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"text/template"
+)
+
+var templateFuncs = template.FuncMap{
+	"env": os.Getenv,
+}
+
+// expandTemplate executes s as a text/template. The values in the header jar
+// are the data of the template, like {{.Authenticate}}, and {{env "NAME"}}
+// returns the value of an environment variable.
+func expandTemplate(name, s string) (string, error) {
+	tmpl, err := template.New(name).Funcs(templateFuncs).Option("missingkey=zero").Parse(s)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	headerJarMu.RLock()
+	defer headerJarMu.RUnlock()
+	if err := tmpl.Execute(&buf, headerJar); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
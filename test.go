@@ -7,16 +7,23 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"mime"
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
 	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 
 	"github.com/xeipuuv/gojsonschema"
 )
 
 var headerJar = make(map[string]string)
 
+// headerJarMu guards the header jar, the tests of a load test run concurrently.
+var headerJarMu sync.RWMutex
+
 type Tests []*Test
 
 type responseHeaderTestCase struct {
@@ -24,31 +31,51 @@ type responseHeaderTestCase struct {
 	Value    string `json:"value"`
 	Validate bool   `json:"validate"`
 	PutInJar bool   `json:"putInJar"`
+	Match    string `json:"match"` // equals, prefix, contains, regex, absent or count
+	All      bool   `json:"all"`   // every value must match instead of one
 }
 
 type Test struct {
-	Label   string        `json:"label"`
-	request *http.Request // contains the actual request
-	Request *struct {
+	Label              string        `json:"label"`
+	request            *http.Request // contains the actual request
+	requestBody        []byte        // contains the actual request body, unless it's streamed from a file
+	requestBodyFile    string        // the file the request body is read from
+	requestBodySize    int64
+	requestContentType string    // the detected content type of the body file
+	query              keyValues // the query parameters of the test itself
+	Request            *struct {
 		Method      string   `json:"method"`
 		URL         *url.URL `json:"url"`
 		URLUserInfo *struct {
 			User     string `json:"user"`
 			Password string `json:"password"`
 		} `json:"urlUserInfo"`
-		TLSInsecureSkipVerify bool `json:"tlsInsecureSkipverify"`
-		NoDefaultHeaders      bool `json:"noDefaultHeaders"`
+		TLSInsecureSkipVerify bool         `json:"tlsInsecureSkipverify"`
+		TLS                   *tlsConfig   `json:"tls"`
+		Proxy                 *proxyConfig `json:"proxy"`
+		UnixSocket            string       `json:"unixSocket"`
+		NoDefaultHeaders      bool         `json:"noDefaultHeaders"`
+		Query                 keyValues    `json:"query"`
+		NoDefaultQuery        bool         `json:"noDefaultQuery"`
 		Headers               []*struct {
 			Key        string `json:"key"`
 			Value      string `json:"value"`
 			UseFromJar bool   `json:"useFromJar"`
 		} `json:"headers"`
-		BodyString string      `json:"bodyString"`
-		BodyJson   interface{} `json:"bodyJson"`
+		BodyString       string           `json:"bodyString"`
+		BodyJson         interface{}      `json:"bodyJson"`
+		BodyFile         string           `json:"bodyFile"`
+		BodyFileTemplate bool             `json:"bodyFileTemplate"`
+		BodyMultipart    []*multipartPart `json:"bodyMultipart"`
+		BodyForm         keyValues        `json:"bodyForm"`
+		Auth             *authConfig      `json:"auth"`
+		Sign             *signConfig      `json:"sign"`
+		FollowRedirects  *maxRedirects    `json:"followRedirects"`
+		Protocol         string           `json:"protocol"`
 	} `json:"request"`
 	response *http.Response // contains the actual response
 	Response *struct {
-		Status           string                    `json:"status,omitempty`
+		Status           string                    `json:"status,omitempty"`
 		StatusCode       int                       `json:"statusCode"`
 		NoDefaultHeaders bool                      `json:"noDefaultHeaders"`
 		Headers          []*responseHeaderTestCase `json:"headers"`
@@ -56,24 +83,73 @@ type Test struct {
 		BodyCheck        bool                   `json:"bodyCheck"`
 		BodyString       string                 `json:"bodyString"`
 		BodyJsonSchema   map[string]interface{} `json:"bodyJsonSchema"`
+		BodyContains     []string               `json:"bodyContains"`
+		BodyNotContains  []string               `json:"bodyNotContains"`
+		BodyMatches      []string               `json:"bodyMatches"` // regular expressions
+		TLS              *tlsCheck              `json:"tls"`
+		Redirects        []*redirectHop         `json:"redirects"`
+		FinalURL         string                 `json:"finalUrl"`
+		Proto            string                 `json:"proto"`
+		Timings          map[string]string      `json:"timings"`
+		MaxDuration      *duration              `json:"maxDuration"`
 		body             []byte
 	} `json:"response"`
 	UseCookieJar      bool `json:"useCookieJar"`
 	NoCookieJar       bool `json:"NoCookieJar"`
 	cookieJar         *cookiejar.Jar
-	PrintDebugOnFail  bool `json:"printDebugOnFail`
+	PrintDebugOnFail  bool `json:"printDebugOnFail"`
 	PrintJsonIndented bool `json:"printJsonIndented"`
 	failed            bool
+	errs              []error     // all errors the test failed on
+	quiet             bool        // if true failures are only recorded, not printed
+	offline           bool        // if true the test is prepared without requesting tokens, like the default test
+	setupErr          error       // the test suite can't continue, like without an OAuth 2.0 token
+	digest            *digestAuth // the expanded credentials of auth.digest
+	client            *http.Client
+	clientCfg         *clientConfig
+	redirects         []*redirectHop // the followed redirects
+	trace             *requestTrace  // the timings of the request
+	maxDuration       time.Duration  // the maximum duration of the request
+	fp                string         // the file the test is read from
+	raw               []byte         // the JSON the test is read from
+}
+
+// UnmarshalJSON keeps the JSON of the test, a load test runs copies of the
+// test made from it. Like for the test files, type errors are ignored.
+func (t *Test) UnmarshalJSON(b []byte) error {
+	type test Test // without the UnmarshalJSON method
+	if err := json.Unmarshal(b, (*test)(t)); err != nil {
+		if _, ok := err.(*json.UnmarshalTypeError); !ok {
+			return err
+		}
+	}
+	t.raw = append([]byte(nil), b...)
+	return nil
+}
+
+// clone returns a new test read from the JSON of the test, it can be prepared
+// and run independently of the test.
+func (t *Test) clone() *Test {
+	c := new(Test)
+	json.Unmarshal(t.raw, c)
+	c.fp = t.fp
+	return c
 }
 
 func (t *Test) Run() bool {
 	defer t.printDebugOnfail()
 	if t.failed {
+		t.closeRequestBody()
 		return false
 	}
 	var err error
-	t.response, err = Call(t.request, t.Request.TLSInsecureSkipVerify)
+	t.trace = newRequestTrace()
+	t.response, err = Call(t.request, t.client, t.digest, t.trace)
+	if err == nil {
+		t.response, err = t.renewOAuth2(t.response)
+	}
 	if err != nil {
+		t.trace.done()
 		t.fail(err)
 		return false
 	}
@@ -81,6 +157,14 @@ func (t *Test) Run() bool {
 	return !t.failed
 }
 
+// closeRequestBody closes the body of a request which isn't sent, like an
+// opened body file.
+func (t *Test) closeRequestBody() {
+	if t.request != nil && t.request.Body != nil {
+		t.request.Body.Close()
+	}
+}
+
 func (t *Test) Prepare(defaultTest *Test) {
 	if t.Request == nil {
 		t.fail(errors.New("cannot execute test because 'request' is missing"))
@@ -102,26 +186,78 @@ func (t *Test) Prepare(defaultTest *Test) {
 			t.Request.Method = defaultTest.Request.Method
 		}
 	}
+	if t.Request.Auth == nil && defaultTest != nil && defaultTest.Request != nil {
+		t.Request.Auth = defaultTest.Request.Auth
+	}
+	if t.Request.Sign == nil && defaultTest != nil && defaultTest.Request != nil {
+		t.Request.Sign = defaultTest.Request.Sign
+	}
+	if t.Request.FollowRedirects == nil && defaultTest != nil && defaultTest.Request != nil {
+		t.Request.FollowRedirects = defaultTest.Request.FollowRedirects
+	}
+	if t.Request.Protocol == "" && defaultTest != nil && defaultTest.Request != nil {
+		t.Request.Protocol = defaultTest.Request.Protocol
+	}
+	t.prepareMaxDuration(defaultTest)
+	t.prepareOwnQuery()
 	t.prepareURL(defaultTest)
+	t.prepareUnixSocket(defaultTest)
+	t.prepareClient(defaultTest)
+	if t.Request.Auth != nil && t.Request.Auth.Basic != nil && t.Request.URL != nil {
+		// basic authentication supersedes the url user info
+		t.Request.URL.User = nil
+	}
 	var body io.Reader
 	var err error
 	if t.Request.BodyString != "" {
-		body = bytes.NewBufferString(t.Request.BodyString)
+		t.requestBody = []byte(t.Request.BodyString)
+		body = bytes.NewBuffer(t.requestBody)
 	} else if t.Request.BodyJson != nil {
-		var b []byte
-		b, err = json.Marshal(t.Request.BodyJson)
+		t.requestBody, err = json.Marshal(t.Request.BodyJson)
 		if err != nil {
 			t.fail(err)
 			return
 		}
-		body = bytes.NewBuffer(b)
+		body = bytes.NewBuffer(t.requestBody)
+	} else if t.Request.BodyFile != "" {
+		if body, err = t.openBodyFile(); err != nil {
+			t.fail(err)
+			return
+		}
+	} else if t.Request.BodyMultipart != nil {
+		if body, err = t.multipartBody(); err != nil {
+			t.fail(err)
+			return
+		}
+	} else if t.Request.BodyForm != nil {
+		t.requestBody = []byte(t.Request.BodyForm.encode())
+		body = bytes.NewBuffer(t.requestBody)
 	}
 	t.request, err = http.NewRequest(t.Request.Method, t.Request.URL.String(), body)
 	if err != nil {
 		t.fail(err)
+		return
+	}
+	if t.requestBodyFile != "" {
+		t.request.ContentLength = t.requestBodySize
+		if t.requestBody == nil {
+			t.request.GetBody = t.reopenBodyFile
+		}
 	}
 	t.prepareHeaders(defaultTest)
+	if t.isMultipart() {
+		// the boundary in the header must match the body
+		t.request.Header.Set("Content-Type", t.requestContentType)
+	} else if t.isForm() {
+		if mediaType, _, _ := mime.ParseMediaType(t.request.Header.Get("Content-Type")); mediaType != "application/x-www-form-urlencoded" {
+			t.request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	} else if t.requestContentType != "" && t.request.Header.Get("Content-Type") == "" {
+		t.request.Header.Set("Content-Type", t.requestContentType)
+	}
+	t.prepareAuth()
 	t.prepareCookies(defaultTest)
+	t.prepareSign()
 }
 
 func (t *Test) prepareURL(defaultTest *Test) {
@@ -131,6 +267,7 @@ func (t *Test) prepareURL(defaultTest *Test) {
 	if t.Request.URLUserInfo != nil && t.Request.URLUserInfo.User != "" {
 		t.Request.URL.User = url.UserPassword(t.Request.URLUserInfo.User, t.Request.URLUserInfo.Password)
 	}
+	t.prepareQuery(defaultTest)
 	if defaultTest == nil || defaultTest.Request == nil || defaultTest.Request.URL == nil {
 		return
 	}
@@ -152,9 +289,6 @@ func (t *Test) prepareURL(defaultTest *Test) {
 	if t.Request.URL.Path == "" {
 		t.Request.URL.Path = defaultTest.Request.URL.Path
 	}
-	if t.Request.URL.RawQuery == "" {
-		t.Request.URL.RawQuery = defaultTest.Request.URL.RawQuery
-	}
 	if t.Request.URL.Fragment == "" {
 		t.Request.URL.Fragment = defaultTest.Request.URL.Fragment
 	}
@@ -168,17 +302,26 @@ func (t *Test) prepareHeaders(defaultTest *Test) {
 	// set request headers
 	if t.Request.NoDefaultHeaders == false && defaultTest != nil && defaultTest.Request != nil && defaultTest.Request.Headers != nil {
 		//TODO test if the default headers get overwritten by the ones in described in the test
-		t.Request.Headers = append(defaultTest.Request.Headers, t.Request.Headers...)
+		// the default headers are copied, the tests of a load test share them
+		t.Request.Headers = append(defaultTest.Request.Headers[:len(defaultTest.Request.Headers):len(defaultTest.Request.Headers)], t.Request.Headers...)
 	}
 
 	if len(t.Request.Headers) > 0 {
 		for _, h := range t.Request.Headers {
+			value := h.Value
 			if h.UseFromJar {
+				headerJarMu.RLock()
 				if v, ok := headerJar[h.Key]; ok {
-					h.Value = v
+					value = v
 				}
+				headerJarMu.RUnlock()
+			}
+			if http.CanonicalHeaderKey(h.Key) == "Host" {
+				// net/http sends the Host field instead of a Host header
+				t.request.Host = value
+				continue
 			}
-			t.request.Header.Add(h.Key, h.Value)
+			t.request.Header.Add(h.Key, value)
 		}
 	}
 
@@ -188,7 +331,7 @@ func (t *Test) prepareHeaders(defaultTest *Test) {
 		for _, defaultTestCase := range defaultTest.Response.Headers {
 			found := false
 			for _, testCase := range t.Response.Headers {
-				if defaultTestCase.Key == testCase.Key {
+				if http.CanonicalHeaderKey(defaultTestCase.Key) == http.CanonicalHeaderKey(testCase.Key) {
 					found = true
 				}
 			}
@@ -227,6 +370,7 @@ func (t *Test) prepareCookies(defaultTest *Test) {
 
 func (t *Test) evaluate() {
 	t.readResponse()
+	t.evaluateDuration()
 	if t.Response == nil {
 		return
 	}
@@ -234,46 +378,58 @@ func (t *Test) evaluate() {
 	t.evaluateStatusCode()
 	t.evaluateStatus()
 	t.evaluateBody()
+	t.evaluateBodyText()
+	t.evaluateTLS()
+	t.evaluateRedirects()
+	t.evaluateProto()
+	t.evaluateTimings()
 }
 
 func (t *Test) readResponse() {
 	if t.response == nil {
 		return
 	}
+	// cookies
+	if cookies := t.response.Cookies(); cookies != nil && !t.NoCookieJar && t.UseCookieJar {
+		// the url of the last request if redirects were followed
+		t.cookieJar.SetCookies(t.response.Request.URL, cookies)
+	}
+	// nothing to test, the body is read to reuse the connection
+	if t.Response == nil {
+		io.Copy(ioutil.Discard, t.response.Body)
+		t.response.Body.Close()
+		t.trace.done()
+		return
+	}
 	// content type
 	if t.response.Header != nil {
 		if v, ok := t.response.Header["Content-Type"]; ok {
 			t.Response.contentType = v[0]
 		}
 	}
-	// cookies
-	if cookies := t.response.Cookies(); cookies != nil && !t.NoCookieJar && t.UseCookieJar {
-		t.cookieJar.SetCookies(t.Request.URL, cookies)
-	}
 	// body
 	if t.Response.body != nil {
 		return
 	}
 	var err error
 	t.Response.body, err = ioutil.ReadAll(t.response.Body)
+	t.trace.done()
 	defer t.response.Body.Close()
 	if err != nil {
-		t.fail(fmt.Errorf("response body read error ", err))
+		t.fail(fmt.Errorf("response body read error %s", err))
 	}
 }
 
 func (t *Test) evaluateHeaders() {
 	if t.Response.Headers != nil {
 		for _, testCase := range t.Response.Headers {
-			value, ok := t.response.Header[testCase.Key]
-			if ok {
-				if testCase.PutInJar && value[0] == testCase.Value {
-					headerJar[testCase.Key] = value[0]
-				} else if testCase.Validate && value[0] != testCase.Value {
-					t.fail(fmt.Errorf("expected header %s to equal %s, given %s", testCase.Key, testCase.Value, value[0]))
-				}
-			} else if testCase.Validate {
-				t.fail(fmt.Errorf("expected header %s to be present", testCase.Key))
+			value := t.response.Header.Values(testCase.Key)
+			if testCase.PutInJar && len(value) > 0 && value[0] == testCase.Value {
+				headerJarMu.Lock()
+				headerJar[testCase.Key] = value[0]
+				headerJarMu.Unlock()
+			} else if testCase.validates() {
+				t.evaluateHeader(testCase)
 			}
 		}
 	}
@@ -321,6 +477,11 @@ func (t *Test) evaluateBody() {
 }
 
 func (t *Test) fail(err error) {
+	t.errs = append(t.errs, err)
+	if t.quiet {
+		t.failed = true
+		return
+	}
 	if t.failed == false {
 		t.failed = true
 		fmt.Println("\n\033[1;31mFAILED\033[0m", t.Label)
@@ -329,11 +490,16 @@ func (t *Test) fail(err error) {
 }
 
 func (t *Test) printDebugOnfail() {
-	if t.failed && t.PrintDebugOnFail {
+	if t.failed && t.PrintDebugOnFail && !t.quiet {
 		fmt.Println("\033[1;36mDEBUG REQUEST\033[0m")
 		// request
-		fmt.Printf("  \033[1;33mURL\033[0m: %s\n", t.Request.URL.String())
-		fmt.Printf("  \033[1;33mHeaders\033[0m: %+v\n", t.request.Header)
+		if t.request != nil {
+			u, header := t.maskedRequest()
+			fmt.Printf("  \033[1;33mURL\033[0m: %s\n", u)
+			fmt.Printf("  \033[1;33mHeaders\033[0m: %+v\n", header)
+		} else {
+			fmt.Printf("  \033[1;33mURL\033[0m: %s\n", t.Request.URL.Redacted())
+		}
 		fmt.Printf("  \033[1;33mBody\033[0m: ")
 		if t.Request.BodyString != "" {
 			fmt.Println(t.Request.BodyString)
@@ -353,9 +519,18 @@ func (t *Test) printDebugOnfail() {
 			} else {
 				fmt.Printf("%s\n", b)
 			}
+		} else if t.requestBodyFile != "" {
+			fmt.Printf("%s (%d bytes, %s)\n", t.requestBodyFile, t.requestBodySize, t.request.Header.Get("Content-Type"))
+		} else if t.isMultipart() {
+			t.printMultipart()
+		} else if t.requestBody != nil {
+			fmt.Printf("%s\n", t.requestBody)
 		} else {
 			fmt.Println("")
 		}
+		if curl := t.curl(true); curl != "" {
+			fmt.Printf("  \033[1;33mcurl\033[0m: %s\n", curl)
+		}
 		//response
 		if t.Response != nil {
 			fmt.Println("\033[1;36mDEBUG RESPONSE\033[0m")
@@ -363,6 +538,12 @@ func (t *Test) printDebugOnfail() {
 				fmt.Printf("  \033[1;33mHeaders\033[0m: %+v\n", t.response.Header)
 				fmt.Printf("  \033[1;33mStatus code\033[0m: %+v\n", t.response.StatusCode)
 				fmt.Printf("  \033[1;33mStatus\033[0m: %+v\n", t.response.Status)
+				fmt.Printf("  \033[1;33mProtocol\033[0m: %s\n", t.response.Proto)
+				fmt.Printf("  \033[1;33mTimings\033[0m: %s\n", t.trace)
+				if t.response.TLS != nil {
+					printTLS(t.response.TLS)
+				}
+				t.printRedirects()
 				if t.Response.body != nil {
 					defaultBodyPrint := false
 					fmt.Printf("  \033[1;33mBody\033[0m: ")
@@ -377,6 +558,10 @@ func (t *Test) printDebugOnfail() {
 						} else {
 							defaultBodyPrint = true
 						}
+					} else if !utf8.Valid(t.Response.body) {
+						fmt.Printf("%d bytes, %s\n", len(t.Response.body), t.Response.contentType)
+					} else {
+						defaultBodyPrint = true
 					}
 					if defaultBodyPrint {
 						fmt.Printf("%s\n", t.Response.body)
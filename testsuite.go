@@ -1,19 +1,54 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"time"
 )
 
 type TestSuite struct {
-	Default                *Test    `json:"default"`
-	First                  []*Test  `json:"first,omitempty"`
-	Includes               []string `json:"includes"`
-	Last                   []*Test  `json:"last,omitempty"`
+	Default                *Test             `json:"default"`
+	First                  []*Test           `json:"first,omitempty"`
+	Includes               []string          `json:"includes"`
+	Last                   []*Test           `json:"last,omitempty"`
+	Resolve                map[string]string `json:"resolve,omitempty"`
+	Slowest                int               `json:"slowest,omitempty"` // the number of slowest tests which are printed
 	total, count, ok, fail int
 	startTime              time.Time
-	fp string
+	fp                     string
+	report                 string // the file the results are written to
+	results                []*testResult
+}
+
+// ReadTestSuite reads the test suite file, the first and last tests get the
+// test suite file as their source file.
+func ReadTestSuite(fp string) (*TestSuite, error) {
+	b, err := ioutil.ReadFile(fp)
+	if err != nil {
+		return nil, err
+	}
+	ts := &TestSuite{fp: filepath.Dir(fp)}
+	if err := json.Unmarshal(b, ts); err != nil {
+		if _, ok := err.(*json.UnmarshalTypeError); !ok {
+			return nil, fmt.Errorf("%s: %s", fp, err)
+		}
+	}
+	if resolveOverrides, err = parseResolve(ts.Resolve); err != nil {
+		return nil, fmt.Errorf("%s: %s", fp, err)
+	}
+	if ts.Default != nil {
+		ts.Default.fp = fp
+	}
+	for _, t := range ts.First {
+		t.fp = fp
+	}
+	for _, t := range ts.Last {
+		t.fp = fp
+	}
+	return ts, nil
 }
 
 func (ts *TestSuite) Run() {
@@ -29,11 +64,16 @@ func (ts *TestSuite) Run() {
 	}
 	ts.total = len(ts.First) + len(tests) + len(ts.Last)
 	fmt.Printf("\033[1;37mExecuted %d of %d\033[0m", ts.count, ts.total)
-	ts.Default.Prepare(nil)
+	if ts.Default != nil {
+		// the default test isn't sent, the tokens are requested by the tests
+		ts.Default.offline = true
+		ts.Default.Prepare(nil)
+	}
 	ts.startTime = time.Now()
 	for _, t := range ts.First {
 		if !ts.runTest(t) {
 			fmt.Println("\n\033[1;31mone of the first tests failed I will not continue to execute the other tests\033[0m")
+			ts.finish()
 			os.Exit(1)
 		}
 	}
@@ -43,11 +83,27 @@ func (ts *TestSuite) Run() {
 	for _, t := range ts.Last {
 		ts.runTest(t)
 	}
+	ts.finish()
+}
+
+// finish prints the slowest tests and writes the report of the executed
+// tests.
+func (ts *TestSuite) finish() {
+	ts.printSlowest(ts.Slowest)
+	if err := ts.writeReport(); err != nil {
+		fmt.Printf("\033[1;31mreport: %s\033[0m\n", err)
+	}
 }
 
 func (ts *TestSuite) runTest(t *Test) bool {
 	t.Prepare(ts.Default)
+	if t.setupErr != nil {
+		fmt.Printf("\n\033[1;31msuite setup failed: %s\033[0m\n", t.setupErr)
+		ts.finish()
+		os.Exit(1)
+	}
 	ok := t.Run()
+	ts.results = append(ts.results, newTestResult(t))
 	ts.count++
 	if ok {
 		ts.ok++
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptrace"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// timingPhases lists the phases of a request in order, the names are used in
+// the timings assertions, the debug info and the report.
+var timingPhases = []string{"dns", "connect", "tls", "ttfb", "download", "total"}
+
+// requestTrace records the timings of a request. The DNS lookup, connect and
+// TLS handshake of every request of a redirect chain are added up, they're 0
+// if a connection is reused. The time to first byte is measured from the
+// start of the last request, total from the start of the first request to the
+// response body being read.
+type requestTrace struct {
+	mu           sync.Mutex // the connect callbacks can run in other goroutines
+	start        time.Time
+	requestStart time.Time
+	firstByte    time.Time
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+	durations    map[string]time.Duration
+}
+
+func newRequestTrace() *requestTrace {
+	return &requestTrace{durations: make(map[string]time.Duration, len(timingPhases))}
+}
+
+// withTrace returns the request with the client trace of the timings.
+func (rt *requestTrace) withTrace(r *http.Request) *http.Request {
+	rt.mu.Lock()
+	now := time.Now()
+	if rt.start.IsZero() {
+		rt.start = now
+	}
+	rt.requestStart = now
+	rt.mu.Unlock()
+	trace := &httptrace.ClientTrace{
+		GetConn: func(string) {
+			rt.mark(&rt.requestStart)
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			rt.mark(&rt.dnsStart)
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			rt.add("dns", rt.dnsStart)
+		},
+		ConnectStart: func(string, string) {
+			rt.mark(&rt.connectStart)
+		},
+		ConnectDone: func(string, string, error) {
+			rt.add("connect", rt.connectStart)
+		},
+		TLSHandshakeStart: func() {
+			rt.mark(&rt.tlsStart)
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			rt.add("tls", rt.tlsStart)
+		},
+		GotFirstResponseByte: func() {
+			rt.mu.Lock()
+			defer rt.mu.Unlock()
+			rt.firstByte = time.Now()
+			rt.durations["ttfb"] = rt.firstByte.Sub(rt.requestStart)
+		},
+	}
+	return r.WithContext(httptrace.WithClientTrace(r.Context(), trace))
+}
+
+func (rt *requestTrace) mark(t *time.Time) {
+	rt.mu.Lock()
+	*t = time.Now()
+	rt.mu.Unlock()
+}
+
+func (rt *requestTrace) add(phase string, start time.Time) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if !start.IsZero() {
+		rt.durations[phase] += time.Since(start)
+	}
+}
+
+// done records the download and total time, it's called when the response
+// body is read.
+func (rt *requestTrace) done() {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	now := time.Now()
+	if !rt.firstByte.IsZero() {
+		rt.durations["download"] = now.Sub(rt.firstByte)
+	}
+	rt.durations["total"] = now.Sub(rt.start)
+}
+
+func (rt *requestTrace) duration(phase string) time.Duration {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	return rt.durations[phase]
+}
+
+func (rt *requestTrace) String() string {
+	parts := make([]string, 0, len(timingPhases))
+	for _, phase := range timingPhases {
+		parts = append(parts, fmt.Sprintf("%s %s", phase, rt.duration(phase).Round(time.Microsecond)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// MarshalJSON returns the timings in milliseconds.
+func (rt *requestTrace) MarshalJSON() ([]byte, error) {
+	m := make(map[string]float64, len(timingPhases))
+	for _, phase := range timingPhases {
+		m[phase] = float64(rt.duration(phase)) / float64(time.Millisecond)
+	}
+	return json.Marshal(m)
+}
+
+// timingCheck is an assertion on a timing like "<200ms", the operator is <,
+// <=, > or >=.
+type timingCheck struct {
+	op string
+	d  time.Duration
+}
+
+func parseTimingCheck(s string) (timingCheck, error) {
+	s = strings.TrimSpace(s)
+	var c timingCheck
+	for _, op := range []string{"<=", ">=", "<", ">"} {
+		if strings.HasPrefix(s, op) {
+			c.op = op
+			break
+		}
+	}
+	if c.op == "" {
+		return c, fmt.Errorf("timing %q must start with <, <=, > or >=", s)
+	}
+	var err error
+	if c.d, err = time.ParseDuration(strings.TrimSpace(s[len(c.op):])); err != nil {
+		return c, fmt.Errorf("timing %q: %s", s, err)
+	}
+	return c, nil
+}
+
+func (c timingCheck) ok(d time.Duration) bool {
+	switch c.op {
+	case "<":
+		return d < c.d
+	case "<=":
+		return d <= c.d
+	case ">":
+		return d > c.d
+	}
+	return d >= c.d
+}
+
+func (t *Test) evaluateTimings() {
+	if len(t.Response.Timings) == 0 {
+		return
+	}
+	phases := make([]string, 0, len(t.Response.Timings))
+	for phase := range t.Response.Timings {
+		phases = append(phases, phase)
+	}
+	sort.Strings(phases)
+	for _, phase := range phases {
+		known := false
+		for _, p := range timingPhases {
+			known = known || p == phase
+		}
+		if !known {
+			t.fail(fmt.Errorf("timings: unknown phase %q, must be one of %s", phase, strings.Join(timingPhases, ", ")))
+			continue
+		}
+		c, err := parseTimingCheck(t.Response.Timings[phase])
+		if err != nil {
+			t.fail(err)
+			continue
+		}
+		if given := t.trace.duration(phase); !c.ok(given) {
+			t.fail(fmt.Errorf("expect %s %s %s, given %s", phase, c.op, c.d, given))
+		}
+	}
+}
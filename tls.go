@@ -0,0 +1,151 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"golang.org/x/crypto/pkcs12"
+)
+
+// tlsConfig describes the TLS settings of a request, paths are relative to the
+// file the settings are read from.
+type tlsConfig struct {
+	CAFile         string `json:"caFile"`
+	CertFile       string `json:"certFile"`
+	KeyFile        string `json:"keyFile"`
+	PKCS12File     string `json:"pkcs12File"`
+	PKCS12Password string `json:"pkcs12Password"`
+	ServerName     string `json:"serverName"`
+	MinVersion     string `json:"minVersion"`
+	MaxVersion     string `json:"maxVersion"`
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// resolve copies the settings which are set to c, paths are made relative to
+// the file of t. A client certificate replaces the one of the default test,
+// whether it's a PEM or a PKCS#12 file.
+func (s *tlsConfig) resolve(c *tlsConfig, t *Test) {
+	if s.CertFile != "" || s.PKCS12File != "" {
+		c.CertFile, c.KeyFile, c.PKCS12File, c.PKCS12Password = "", "", "", ""
+	}
+	for _, v := range []struct {
+		from string
+		to   *string
+		path bool
+	}{
+		{s.CAFile, &c.CAFile, true},
+		{s.CertFile, &c.CertFile, true},
+		{s.KeyFile, &c.KeyFile, true},
+		{s.PKCS12File, &c.PKCS12File, true},
+		{s.PKCS12Password, &c.PKCS12Password, false},
+		{s.ServerName, &c.ServerName, false},
+		{s.MinVersion, &c.MinVersion, false},
+		{s.MaxVersion, &c.MaxVersion, false},
+	} {
+		if v.from == "" {
+			continue
+		}
+		*v.to = v.from
+		if v.path {
+			*v.to = t.relativePath(v.from)
+		}
+	}
+}
+
+func (c clientConfig) tlsClientConfig() (*tls.Config, error) {
+	cfg := &tls.Config{
+		InsecureSkipVerify: c.InsecureSkipVerify,
+		ServerName:         c.TLS.ServerName,
+	}
+	var ok bool
+	if c.TLS.MinVersion != "" {
+		if cfg.MinVersion, ok = tlsVersions[c.TLS.MinVersion]; !ok {
+			return nil, fmt.Errorf("tls.minVersion must be 1.0, 1.1, 1.2 or 1.3, given %q", c.TLS.MinVersion)
+		}
+	}
+	if c.TLS.MaxVersion != "" {
+		if cfg.MaxVersion, ok = tlsVersions[c.TLS.MaxVersion]; !ok {
+			return nil, fmt.Errorf("tls.maxVersion must be 1.0, 1.1, 1.2 or 1.3, given %q", c.TLS.MaxVersion)
+		}
+	}
+	if c.TLS.CAFile != "" {
+		b, err := ioutil.ReadFile(c.TLS.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("%s: no PEM encoded certificates found", c.TLS.CAFile)
+		}
+	}
+	switch {
+	case c.TLS.CertFile != "":
+		keyFile := c.TLS.KeyFile
+		if keyFile == "" {
+			// the key can be in the certificate file
+			keyFile = c.TLS.CertFile
+		}
+		cert, err := tls.LoadX509KeyPair(c.TLS.CertFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	case c.TLS.PKCS12File != "":
+		cert, err := loadPKCS12(c.TLS.PKCS12File, c.TLS.PKCS12Password)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", c.TLS.PKCS12File, err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	case c.TLS.KeyFile != "":
+		return nil, errors.New("tls.keyFile is set without tls.certFile")
+	}
+	return cfg, nil
+}
+
+// loadPKCS12 reads the client certificate, its chain and private key from a
+// PKCS#12 file. The certificates can be in any order in the file, the one
+// matching the private key is used as leaf.
+func loadPKCS12(fp, password string) (tls.Certificate, error) {
+	b, err := ioutil.ReadFile(fp)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	blocks, err := pkcs12.ToPEM(b, password)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	var keyPEM []byte
+	certs := make([]*pem.Block, 0, len(blocks))
+	for _, block := range blocks {
+		if block.Type == "CERTIFICATE" {
+			certs = append(certs, block)
+		} else {
+			keyPEM = pem.EncodeToMemory(block)
+		}
+	}
+	if keyPEM == nil || len(certs) == 0 {
+		return tls.Certificate{}, errors.New("certificate or private key missing")
+	}
+	for i := range certs {
+		certPEM := pem.EncodeToMemory(certs[i])
+		for j, block := range certs {
+			if j != i {
+				certPEM = append(certPEM, pem.EncodeToMemory(block)...)
+			}
+		}
+		if cert, err := tls.X509KeyPair(certPEM, keyPEM); err == nil {
+			return cert, nil
+		}
+	}
+	return tls.Certificate{}, errors.New("no certificate matches the private key")
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// tlsCheck describes the expected TLS connection of a response. The server
+// certificate is checked too if tlsInsecureSkipverify is true.
+type tlsCheck struct {
+	Version       string   `json:"version"`
+	CipherSuite   string   `json:"cipherSuite"`
+	ALPN          string   `json:"alpn"`
+	Subject       string   `json:"subject"`
+	SANs          []string `json:"sans"`
+	Issuer        string   `json:"issuer"`
+	ExpiresInDays int      `json:"expiresInDays"` // more than
+}
+
+func tlsVersionName(version uint16) string {
+	for name, v := range tlsVersions {
+		if v == version {
+			return name
+		}
+	}
+	return fmt.Sprintf("0x%04x", version)
+}
+
+func (t *Test) evaluateTLS() {
+	c := t.Response.TLS
+	if c == nil {
+		return
+	}
+	state := t.response.TLS
+	if state == nil {
+		t.fail(errors.New("expect a TLS connection, the response isn't received over TLS"))
+		return
+	}
+	if c.Version != "" && c.Version != tlsVersionName(state.Version) {
+		t.fail(fmt.Errorf("expect TLS version %s, given %s", c.Version, tlsVersionName(state.Version)))
+	}
+	if c.CipherSuite != "" && c.CipherSuite != tls.CipherSuiteName(state.CipherSuite) {
+		t.fail(fmt.Errorf("expect cipher suite %s, given %s", c.CipherSuite, tls.CipherSuiteName(state.CipherSuite)))
+	}
+	if c.ALPN != "" && c.ALPN != state.NegotiatedProtocol {
+		t.fail(fmt.Errorf("expect ALPN protocol %q, given %q", c.ALPN, state.NegotiatedProtocol))
+	}
+	if c.Subject == "" && len(c.SANs) == 0 && c.Issuer == "" && c.ExpiresInDays == 0 {
+		return
+	}
+	if len(state.PeerCertificates) == 0 {
+		t.fail(errors.New("expect a server certificate"))
+		return
+	}
+	cert := state.PeerCertificates[0]
+	if c.Subject != "" && c.Subject != cert.Subject.String() && c.Subject != cert.Subject.CommonName {
+		t.fail(fmt.Errorf("expect certificate subject %q, given %q", c.Subject, cert.Subject))
+	}
+	if c.Issuer != "" && c.Issuer != cert.Issuer.String() && c.Issuer != cert.Issuer.CommonName {
+		t.fail(fmt.Errorf("expect certificate issuer %q, given %q", c.Issuer, cert.Issuer))
+	}
+	sans := certificateSANs(cert)
+	for _, san := range c.SANs {
+		found := false
+		for _, s := range sans {
+			if s == san {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.fail(fmt.Errorf("expect certificate subject alternative name %q, given %q", san, sans))
+		}
+	}
+	if c.ExpiresInDays != 0 && !cert.NotAfter.After(time.Now().AddDate(0, 0, c.ExpiresInDays)) {
+		t.fail(fmt.Errorf("expect certificate to expire in more than %d days, it expires in %d days on %s",
+			c.ExpiresInDays, int(time.Until(cert.NotAfter).Hours()/24), cert.NotAfter.Format(time.RFC3339)))
+	}
+}
+
+// certificateSANs returns the DNS names, IP addresses, email addresses and
+// URIs of the certificate.
+func certificateSANs(cert *x509.Certificate) []string {
+	sans := make([]string, 0, len(cert.DNSNames)+len(cert.IPAddresses))
+	sans = append(sans, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	sans = append(sans, cert.EmailAddresses...)
+	for _, u := range cert.URIs {
+		sans = append(sans, u.String())
+	}
+	return sans
+}
+
+// printTLS prints the TLS connection state of the response.
+func printTLS(state *tls.ConnectionState) {
+	fmt.Printf("  \033[1;33mTLS\033[0m: TLS %s %s", tlsVersionName(state.Version), tls.CipherSuiteName(state.CipherSuite))
+	if state.NegotiatedProtocol != "" {
+		fmt.Printf(" ALPN %s", state.NegotiatedProtocol)
+	}
+	fmt.Println("")
+	if len(state.PeerCertificates) > 0 {
+		cert := state.PeerCertificates[0]
+		fmt.Printf("  \033[1;33mCertificate\033[0m: %s, issuer %s, SANs %v, expires %s\n",
+			cert.Subject, cert.Issuer, certificateSANs(cert), cert.NotAfter.Format(time.RFC3339))
+	}
+}
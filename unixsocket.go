@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// unixSocketPath returns the path of a unix socket given as path or as
+// unix:// url.
+func unixSocketPath(socket string) string {
+	return strings.TrimPrefix(socket, "unix://")
+}
+
+// unixSocketDialer connects to the unix socket whatever the address of the
+// request is, the url host is only sent as Host header.
+func unixSocketDialer(socket string) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	var d net.Dialer
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return d.DialContext(ctx, "unix", socket)
+	}
+}
+
+// prepareUnixSocket sets the scheme and host of the url of a request to a
+// unix socket if they're not set, the host is sent as Host header. The url can
+// be left out, it's http://localhost then.
+func (t *Test) prepareUnixSocket(defaultTest *Test) {
+	if t.Request.UnixSocket == "" && defaultTest != nil && defaultTest.Request != nil {
+		t.Request.UnixSocket = defaultTest.Request.UnixSocket
+	}
+	if t.Request.UnixSocket == "" {
+		return
+	}
+	if t.Request.URL == nil {
+		t.Request.URL = &url.URL{}
+	}
+	if t.Request.URL.Scheme == "" {
+		t.Request.URL.Scheme = "http"
+	}
+	if t.Request.URL.Host == "" {
+		t.Request.URL.Host = "localhost"
+	}
+}